@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/readr-media/readr-restful/models"
+)
+
+// requestIDKey is the context key of the ID of a request
+const requestIDKey = "request_id"
+
+// setRequestID tags the request with an ID, logged in the audit log with its writes.
+// An X-Request-ID set by the client or a proxy is kept.
+func setRequestID(c *gin.Context) {
+	id := c.GetHeader("X-Request-ID")
+	if id == "" || len(id) > 64 {
+		b := make([]byte, 16)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	c.Set(requestIDKey, id)
+	c.Header("X-Request-ID", id)
+	c.Next()
+}
+
+// claimedActorKey is the context key of who the client says makes a request
+const claimedActorKey = "claimed_actor"
+
+// claimActor keeps the X-Actor the client tells who makes the request with.
+// Nothing vouches for it, so it is logged in the audit log apart from the authenticated actor.
+func claimActor(c *gin.Context) {
+	actor := c.GetHeader("X-Actor")
+	if len(actor) > 64 {
+		abortWithError(c, models.NewError(models.ErrValidation, "Invalid X-Actor", nil))
+		return
+	}
+	c.Set(claimedActorKey, actor)
+	c.Next()
+}
+
+// datastore returns the Datastore to go through on behalf of the caller of the request.
+// The client is told apart by its address, so that it reads its own writes from the primary.
+func (h resourceHandlers) datastore(c *gin.Context) models.Datastore {
+	return h.env.db.As(models.Caller{
+		Actor:        c.GetString(gin.AuthUserKey),
+		ClaimedActor: c.GetString(claimedActorKey),
+		RequestID:    c.GetString(requestIDKey),
+		Client:       c.ClientIP(),
+	})
+}
+
+// requireAdmin lets through the requests bearing the admin token
+func (env *Env) requireAdmin(c *gin.Context) {
+
+	if err := env.authorizeAdmin(c); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.Next()
+}
+
+// authorizeAdmin checks that the request bears the admin token, and makes the admin its caller.
+// Admin endpoints are disabled unless a token is configured.
+func (env *Env) authorizeAdmin(c *gin.Context) error {
+
+	if env.adminToken == "" {
+		return models.NewError(errForbidden, "Admin Endpoints Disabled", nil)
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(env.adminToken)) != 1 {
+		c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+		return models.NewError(errUnauthorized, "Admin Token Required", nil)
+	}
+	c.Set(gin.AuthUserKey, "admin")
+	return nil
+}
+
+// Audit lists the audit log, newest first, filtered by actor, claimed_actor, resource, id and a since/until time range
+func (env *Env) Audit(c *gin.Context) {
+
+	q := models.AuditQuery{Actor: c.Query("actor"), ClaimedActor: c.Query("claimed_actor"), Resource: c.Query("resource"), RecordID: c.Query("id")}
+	var err error
+	if q.Limit, q.Offset, err = bindPage(c); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	for param, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if value := c.Query(param); value != "" {
+			if *t, err = time.Parse(time.RFC3339, value); err != nil {
+				invalid(c, "Invalid "+param)
+				return
+			}
+		}
+	}
+	entries, total, err := env.db.ListAudit(q)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"_items": entries,
+		"_meta":  listMeta{Total: total, Limit: q.Limit, Offset: q.Offset},
+	})
+}
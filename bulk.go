@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/readr-media/readr-restful/models"
+)
+
+// bulkRequest is the body of POST /{plural}/bulk.
+// Mode is either all_or_nothing, the default, or best_effort.
+// Creates and updates carry the record in Item, deletes only need the ID.
+type bulkRequest struct {
+	Mode       string          `json:"mode"`
+	Operations []bulkOperation `json:"operations"`
+}
+
+type bulkOperation struct {
+	Op   string          `json:"op"`
+	ID   string          `json:"id"`
+	Item json.RawMessage `json:"item"`
+}
+
+// bulkResult is the outcome of one operation, in the order of the request
+type bulkResult struct {
+	Index  int      `json:"index"`
+	Op     string   `json:"op"`
+	ID     string   `json:"id,omitempty"`
+	Status int      `json:"status"`
+	Error  *problem `json:"error,omitempty"`
+}
+
+// operation turns an operation of the request into one for models.RunBulk
+func (h resourceHandlers) operation(o bulkOperation) (models.BulkOperation, error) {
+
+	op := models.BulkOperation{Op: o.Op}
+	decode := func(v interface{}) error { return json.Unmarshal(o.Item, v) }
+
+	switch o.Op {
+	case models.BulkCreate:
+		item, err := h.res.Decode(decode)
+		if err != nil {
+			return op, err
+		}
+		op.Item = h.res.PrepareCreate(item)
+	case models.BulkUpdate:
+		item, err := h.res.Decode(decode)
+		if err != nil {
+			return op, err
+		}
+		op.Item = h.res.PrepareUpdate(item)
+	case models.BulkDelete:
+		if o.ID == "" {
+			return op, models.NewError(models.ErrValidation, h.res.Invalid, nil)
+		}
+		op.Item = h.res.WithID(o.ID)
+	default:
+		return op, models.NewError(models.ErrValidation, "Invalid Operation: "+o.Op, nil)
+	}
+	return op, nil
+}
+
+// Bulk runs a batch of creates, updates and deletes.
+// It answers 200 if every operation succeeded, and 207 with the outcome of each of them otherwise.
+func (h resourceHandlers) Bulk(c *gin.Context) {
+
+	req := bulkRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, models.NewError(models.ErrValidation, "Invalid Bulk Request", err))
+		return
+	}
+	atomic := true
+	switch req.Mode {
+	case "", "all_or_nothing":
+	case "best_effort":
+		atomic = false
+	default:
+		invalid(c, "Invalid Bulk Mode")
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > models.MaxBulkOperations {
+		invalid(c, "Invalid Number Of Operations")
+		return
+	}
+
+	// Malformed operations are reported without running them.
+	// In all-or-nothing mode they abort the whole request.
+	results := make([]bulkResult, len(req.Operations))
+	errs := make([]error, len(req.Operations))
+	ops := make([]models.BulkOperation, 0, len(req.Operations))
+	indexes := make([]int, 0, len(req.Operations))
+	for i, o := range req.Operations {
+		results[i] = bulkResult{Index: i, Op: o.Op}
+		op, err := h.operation(o)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		results[i].ID = h.res.IDOf(op.Item)
+		ops = append(ops, op)
+		indexes = append(indexes, i)
+	}
+
+	failed := len(ops) < len(req.Operations)
+	if failed && atomic {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = models.AbortedError
+			}
+		}
+	} else {
+		for j, err := range models.RunBulk(h.datastore(c), ops, atomic) {
+			errs[indexes[j]] = err
+		}
+	}
+
+	status := http.StatusOK
+	for i, err := range errs {
+		if err != nil {
+			p := newProblem(err)
+			results[i].Status, results[i].Error = p.Status, &p
+			status = http.StatusMultiStatus
+			continue
+		}
+		results[i].Status = http.StatusOK
+		if results[i].Op == models.BulkCreate {
+			results[i].Status = http.StatusCreated
+		}
+	}
+	c.JSON(status, gin.H{"_items": results})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/readr-media/readr-restful/models"
+)
+
+// cacheRules holds the Cache-Control directives of routes, set with repeated --cache-control flags
+type cacheRules map[string]string
+
+func (rules cacheRules) String() string {
+	return strings.Join(rules.Values(), " ")
+}
+
+// Values returns the rules as PATH=DIRECTIVES, sorted by path
+func (rules cacheRules) Values() []string {
+	paths := make([]string, 0, len(rules))
+	for path := range rules {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for i, path := range paths {
+		paths[i] = path + "=" + rules[path]
+	}
+	return paths
+}
+
+// Set parses a PATH=DIRECTIVES rule
+func (rules cacheRules) Set(rule string) error {
+	i := strings.Index(rule, "=")
+	if i < 0 || !strings.HasPrefix(rule, "/") || strings.TrimSpace(rule[i+1:]) == "" {
+		return fmt.Errorf("invalid cache rule %q, expected PATH=DIRECTIVES", rule)
+	}
+	rules[rule[:i]] = strings.TrimSpace(rule[i+1:])
+	return nil
+}
+
+// cacheTTLs holds how long the records of resources stay in the read cache, set with repeated --cache-ttl flags
+type cacheTTLs models.CacheTTLs
+
+func (ttls cacheTTLs) String() string {
+	return strings.Join(ttls.Values(), " ")
+}
+
+// Values returns the TTLs as RESOURCE=DURATION, sorted by resource
+func (ttls cacheTTLs) Values() []string {
+	names := make([]string, 0, len(ttls))
+	for name := range ttls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + ttls[name].String()
+	}
+	return names
+}
+
+// Set parses a RESOURCE=DURATION rule
+func (ttls cacheTTLs) Set(rule string) error {
+	i := strings.Index(rule, "=")
+	if i < 0 {
+		return fmt.Errorf("invalid cache TTL %q, expected RESOURCE=DURATION", rule)
+	}
+	ttl, err := time.ParseDuration(rule[i+1:])
+	if err != nil {
+		return fmt.Errorf("invalid cache TTL %q: %v", rule, err)
+	}
+	for _, res := range models.Resources() {
+		if res.Name == rule[:i] {
+			ttls[res.Name] = ttl
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid cache TTL %q, no resource is named %s", rule, rule[:i])
+}
+
+// setCacheControl applies the directives configured for the route to GET responses.
+// Errors are never cached, see abortWithError.
+func (env *Env) setCacheControl(c *gin.Context) {
+	if directives, ok := env.cacheControl[c.FullPath()]; ok && c.Request.Method == http.MethodGet {
+		c.Header("Cache-Control", directives)
+	}
+	c.Next()
+}
+
+// setValidators tags the response with the ETag and Last-Modified of result, if it is a stamped record
+func (h resourceHandlers) setValidators(c *gin.Context, result interface{}) {
+	item, ok := result.(models.TableStruct)
+	if !ok {
+		return
+	}
+	if version, ok := h.res.Version(item); ok {
+		c.Header("ETag", h.res.ETag(item))
+		c.Header("Last-Modified", version.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified evaluates the If-None-Match and If-Modified-Since headers of a GET against item.
+// If-Modified-Since is ignored when If-None-Match is given, as RFC 7232 requires.
+func (h resourceHandlers) notModified(c *gin.Context, item models.TableStruct) bool {
+
+	version, ok := h.res.Version(item)
+	if header := c.GetHeader("If-None-Match"); header != "" {
+		if strings.TrimSpace(header) == "*" {
+			return true
+		}
+		if !ok {
+			return false
+		}
+		// Weak comparison, so W/ tags of the same version match as well
+		etag := h.res.ETag(item)
+		for _, tag := range strings.Split(header, ",") {
+			if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if header := c.GetHeader("If-Modified-Since"); header != "" && ok {
+		since, err := http.ParseTime(header)
+		return err == nil && !version.Truncate(time.Second).After(since)
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Every setting is a flag, which can be set in the environment and in a config file as well.
+// The command line wins over the environment, which wins over the file, which wins over the defaults.
+// Keys of the file are the names of the flags, e.g. sql-user, and variables are named after them,
+// upper-cased, with underscores for dashes and prefixed with READR_, e.g. READR_SQL_USER.
+// Repeatable flags take a list in the file, and values separated by spaces in the environment.
+
+var configFile = flag.String("config", "", "Config file, YAML or TOML as told by its extension; also READR_CONFIG")
+
+// secrets are the settings which are never shown, see printConfig
+var secrets = map[string]bool{"sql-auth": true, "admin-token": true}
+
+// repeatable is implemented by the flags which can be given more than once
+type repeatable interface {
+	flag.Value
+	Values() []string
+}
+
+// envName returns the environment variable of the flag name
+func envName(name string) string {
+	return "READR_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// loadConfig sets the flags of fs left off the command line from the environment, then from the config file.
+// fs is expected to be parsed already.
+func loadConfig(fs *flag.FlagSet, lookupEnv func(string) (string, bool)) error {
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := lookupEnv(envName(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		values := []string{value}
+		if _, ok := f.Value.(repeatable); ok {
+			values = strings.Fields(value)
+		}
+		for _, value := range values {
+			if err = fs.Set(f.Name, value); err != nil {
+				err = fmt.Errorf("invalid %s: %v", envName(f.Name), err)
+				return
+			}
+		}
+		set[f.Name] = true
+	})
+	if err != nil {
+		return err
+	}
+
+	path := ""
+	if f := fs.Lookup("config"); f != nil {
+		path = f.Value.String()
+	}
+	if path == "" {
+		return nil
+	}
+	settings, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	for name, setting := range settings {
+		f := fs.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("%s: unknown setting %s", path, name)
+		}
+		if set[name] {
+			continue
+		}
+		values, ok := setting.([]interface{})
+		if !ok {
+			values = []interface{}{setting}
+		}
+		for _, value := range values {
+			if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+				return fmt.Errorf("%s: invalid %s: %v", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readConfigFile decodes the settings of the config file at path, in TOML if it ends with .toml and in YAML otherwise
+func readConfigFile(path string) (map[string]interface{}, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	settings := make(map[string]interface{})
+	if filepath.Ext(path) == ".toml" {
+		err = toml.Unmarshal(data, &settings)
+	} else {
+		err = yaml.Unmarshal(data, &settings)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return settings, nil
+}
+
+// printConfig writes the effective settings of fs as a YAML config file, with the secrets redacted
+func printConfig(fs *flag.FlagSet, out io.Writer) error {
+
+	settings := make(map[string]interface{})
+	fs.VisitAll(func(f *flag.Flag) {
+		switch value := f.Value.(type) {
+		case repeatable:
+			settings[f.Name] = value.Values()
+			return
+		case flag.Getter:
+			switch v := value.Get().(type) {
+			case bool, int, int64, uint, uint64, float64:
+				settings[f.Name] = v
+				return
+			case time.Duration:
+				settings[f.Name] = v.String()
+				return
+			}
+		}
+		settings[f.Name] = redacted(f.Name, f.Value.String())
+	})
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// redacted returns value, unless the setting name is a secret
+func redacted(name string, value string) string {
+	if secrets[name] && value != "" {
+		return "REDACTED"
+	}
+	return value
+}
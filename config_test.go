@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigLayersFlagsOverEnvironmentOverFile(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "readr.yaml")
+	file := "sql-user: file\nsql-address: file:3306\nsql-auth: secret\nsql-replica:\n  - replica1:3306\n  - replica2:3306\n"
+	if err := os.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"READR_CONFIG": path, "READR_SQL_USER": "env", "READR_SQL_ADDRESS": "env:3306"}
+
+	fs := flag.NewFlagSet("readr-restful", flag.ContinueOnError)
+	fs.String("config", "", "")
+	user := fs.String("sql-user", "root", "")
+	address := fs.String("sql-address", "127.0.0.1:3306", "")
+	fs.String("sql-auth", "", "")
+	replicas := addressList{}
+	fs.Var(&replicas, "sql-replica", "")
+	if err := fs.Parse([]string{"--sql-user=flag"}); err != nil {
+		t.Fatal(err)
+	}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	if err := loadConfig(fs, lookupEnv); err != nil {
+		t.Fatal(err)
+	}
+
+	if *user != "flag" || *address != "env:3306" || len(replicas) != 2 || replicas[1] != "replica2:3306" {
+		t.Errorf("Expected flags over the environment over the file, got %s %s %v", *user, *address, replicas)
+	}
+
+	var out bytes.Buffer
+	if err := printConfig(fs, &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "secret") || !strings.Contains(out.String(), "sql-auth: REDACTED") {
+		t.Errorf("Expected the password to be redacted, got\n%s", out.String())
+	}
+
+	if err := os.WriteFile(path, []byte("sql-port: 3306\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(fs, lookupEnv); err == nil {
+		t.Error("Expected an unknown setting to be refused")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/readr-media/readr-restful/models"
+)
+
+// readyTimeout bounds the checks of the dependencies made by Readyz
+const readyTimeout = 2 * time.Second
+
+// Livez tells that the process serves requests, whatever the state of its dependencies,
+// so that it is restarted only if it hangs
+func (env *Env) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz tells whether the server should be sent traffic: it fails while shutting down
+// and while a dependency which isn't optional is down, and reports every dependency
+func (env *Env) Readyz(c *gin.Context) {
+
+	status, code := "ok", http.StatusOK
+	if atomic.LoadInt32(&env.draining) == 1 {
+		status, code = "shutting down", http.StatusServiceUnavailable
+	}
+	dependencies := []models.Health{}
+	if env.health != nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+		defer cancel()
+		dependencies = env.health(ctx)
+	}
+	for _, dependency := range dependencies {
+		if !dependency.Up && !dependency.Optional && code == http.StatusOK {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(code, gin.H{"status": status, "dependencies": dependencies})
+}
+
+// DebugDB reports the connection pools of the database, the primary first and then the replicas
+func (env *Env) DebugDB(c *gin.Context) {
+
+	if env.poolStats == nil {
+		abortWithError(c, models.NewError(models.ErrNotFound, "Pool Stats Unavailable", nil))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pools": env.poolStats()})
+}
+
+// drain fails the readiness of the server, which is shutting down
+func (env *Env) drain() {
+	atomic.StoreInt32(&env.draining, 1)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+
+	"github.com/readr-media/readr-restful/models"
+)
+
+// migrate runs the migrate subcommand: up applies every pending migration,
+// down [steps] reverts the latest ones (1 by default), and status lists them all.
+func migrate(db *models.DB, args []string, out io.Writer) error {
+
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [steps]|status")
+	}
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp()
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+			steps = n
+		}
+		reverted, err := db.MigrateDown(steps)
+		for _, m := range reverted {
+			fmt.Fprintf(out, "reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		status, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			appliedAt := "pending"
+			if s.AppliedAt.Valid {
+				appliedAt = "applied " + s.AppliedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command: %s", args[0])
+}
+
+// checkSchema compares the tables against the models before the server starts.
+// Every mismatch is logged; in strict mode, columns missing from a table refuse the start.
+func checkSchema(db *models.DB, mode string) error {
+
+	if mode == "off" {
+		return nil
+	}
+	if mode != "strict" && mode != "warn" {
+		return fmt.Errorf("invalid schema check mode: %s", mode)
+	}
+	mismatches, err := db.ValidateSchema()
+	if err != nil {
+		return err
+	}
+	breaking := false
+	for _, m := range mismatches {
+		log.Printf("schema mismatch: %s", m)
+		breaking = breaking || m.Breaking()
+	}
+	if breaking && mode == "strict" {
+		return fmt.Errorf("the schema doesn't match the models, run migrate up or start with --schema-check=warn")
+	}
+	return nil
+}
@@ -1,96 +1,73 @@
 package models
 
 import (
-	"database/sql"
-	"errors"
-	"fmt"
-	"log"
-	"strings"
+	"time"
 )
 
 type Article struct {
 	ID            string     `json:"id" db:"post_id"`
 	Author        NullString `json:"author" db:"author"`
 	CreateTime    NullTime   `json:"created_at" db:"create_time"`
-	LikeAmount    int        `json:"liked" db:"like_amount"`
-	CommentAmount int        `json:"comment_amount" db:"comment_amount"`
+	LikeAmount    NullInt    `json:"liked" db:"like_amount"`
+	CommentAmount NullInt    `json:"comment_amount" db:"comment_amount"`
 	Title         NullString `json:"title" db:"title"`
 	Content       NullString `json:"content" db:"content"`
 	Link          NullString `json:"link" db:"link"`
 	OgTitle       NullString `json:"og_title" db:"og_title"`
 	OgDescription NullString `json:"og_description" db:"og_description"`
 	OgImage       NullString `json:"og_image" db:"og_image"`
-	Active        int        `json:"active" db:"active"`
+	Active        NullInt    `json:"active" db:"active"`
 	UpdatedAt     NullTime   `json:"updated_at" db:"updated_at"`
 	UpdatedBy     NullString `json:"updated_by" db:"updated_by"`
 }
 
-func (a Article) GetFromDatabase(db *DB) (TableStruct, error) {
-	article := Article{}
-	err := db.QueryRowx("SELECT * FROM article_infos WHERE post_id = ?", a.ID).StructScan(&article)
-	switch {
-	case err == sql.ErrNoRows:
-		err = errors.New("Article Not Found")
-		article = Article{}
-	case err != nil:
-		log.Fatal(err)
-		article = Article{}
-	default:
-		fmt.Printf("Successfully get article: %v\n", a.ID)
-		err = nil
-	}
-	return article, err
+func init() {
+	Register(Resource{
+		Name:          "article",
+		Plural:        "articles",
+		Table:         "article_infos",
+		PrimaryKey:    "post_id",
+		Model:         Article{},
+		Required:      []string{"author", "title"},
+		RevisionTable: "article_revisions",
+		NotFound:      "Article Not Found",
+		Conflict:      "Article ID Already Taken",
+		Invalid:       "Invalid Article Data",
+		// New articles are always published
+		OnCreate: func(item TableStruct) TableStruct {
+			article := item.(Article)
+			article.Active = NullInt{Int: 1, Valid: true}
+			return article
+		},
+	})
 }
 
-func (a Article) InsertIntoDatabase(db *DB) error {
+func (a Article) GetFromDatabase(db Runner) (TableStruct, error) {
+	return getFromTable(db, a)
+}
 
-	query, _ := generateSQLStmt(a, "insert", "article_infos")
-	result, err := db.NamedExec(query, a)
-	if err != nil {
-		if strings.Contains(err.Error(), "Duplicate entry") {
-			return errors.New("Duplicate entry")
-		}
-		return err
-	}
-	rowCnt, err := result.RowsAffected()
-	if err != nil {
-		log.Fatal(err)
-	}
-	if rowCnt > 1 {
-		return errors.New("More Than One Rows Affected")
-	} else if rowCnt == 0 {
-		return errors.New("Article Not Found")
-	}
-	return nil
+func (a Article) InsertIntoDatabase(db Runner) error {
+	return insertIntoTable(db, a)
 }
 
-func (a Article) UpdateDatabase(db *DB) error {
+func (a Article) UpdateDatabase(db Runner) error {
+	return updateTable(db, a)
+}
 
-	query, err := generateSQLStmt(a, "partial_update", "article_infos")
-	if err != nil {
-		return errors.New("Generate SQL statement failed")
-	}
-	result, err := db.NamedExec(query, a)
+func (a Article) ReplaceInDatabase(db Runner) error {
+	return replaceInTable(db, a)
+}
 
-	if err != nil {
-		return err
-	}
-	rowCnt, err := result.RowsAffected()
-	if rowCnt > 1 {
-		return errors.New("More Than One Rows Affected")
-	} else if rowCnt == 0 {
-		return errors.New("Article Not Found")
-	}
-	return nil
+func (a Article) DeleteFromDatabase(db Runner) error {
+	return deleteFromTable(db, a)
 }
 
-func (a Article) DeleteFromDatabase(db *DB) error {
+func (a Article) PurgeFromDatabase(db Runner, before time.Time) (int64, error) {
+	return purgeFromTable(db, a, before)
+}
 
-	_, err := db.Exec("UPDATE article_infos SET active = 0 WHERE post_id = ?", a.ID)
-	if err != nil {
-		log.Println(err)
-	} else {
-		err = nil
-	}
-	return err
+// ListFromDatabase returns the articles matching the filters of args.
+// Unless told otherwise, articles are ordered by create_time, newest first.
+func (a Article) ListFromDatabase(db Runner, args ListArgs) (ListResult, error) {
+	return listFromTable(db, a, args)
 }
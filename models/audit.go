@@ -0,0 +1,259 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Operations recorded in the audit log
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditReplace = "replace"
+	AuditDelete  = "delete"
+	AuditPurge   = "purge"
+)
+
+// Caller identifies who a write is made for.
+// Actor is the authenticated caller, if any, while ClaimedActor is who the client says it is, which nothing vouches for.
+// RequestID ties the write to the request which made it.
+// Client tells the client apart across its requests, so that it reads its own writes, see DB.StickyWindow.
+type Caller struct {
+	Actor        string
+	ClaimedActor string
+	RequestID    string
+	Client       string
+}
+
+// AuditEntry is a row of the audit_log table, which is only ever appended to.
+// Actor is the authenticated caller, and ClaimedActor who the client said made the write, see Caller.
+// Before and After are the JSON of the record around the write: Before is null for creates,
+// and After is null for records deleted for real.
+type AuditEntry struct {
+	ID           int64      `json:"id" db:"audit_id"`
+	Actor        NullString `json:"actor" db:"actor"`
+	ClaimedActor NullString `json:"claimed_actor" db:"claimed_actor"`
+	Resource     string     `json:"resource" db:"resource"`
+	RecordID     string     `json:"record_id" db:"record_id"`
+	Operation    string     `json:"operation" db:"operation"`
+	Before       NullJSON   `json:"before" db:"before_state"`
+	After        NullJSON   `json:"after" db:"after_state"`
+	RequestID    NullString `json:"request_id" db:"request_id"`
+	CreatedAt    NullTime   `json:"created_at" db:"created_at"`
+}
+
+// AuditQuery selects entries of the audit log. Empty fields match every entry.
+type AuditQuery struct {
+	Actor        string
+	ClaimedActor string
+	Resource     string
+	RecordID     string
+	Since        time.Time
+	Until        time.Time
+	Limit        int
+	Offset       int
+}
+
+// NullJSON is a nullable JSON document
+type NullJSON struct {
+	JSON  json.RawMessage
+	Valid bool
+}
+
+func (nj *NullJSON) Scan(value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		nj.JSON, nj.Valid = nil, false
+	case []byte:
+		nj.JSON, nj.Valid = append(json.RawMessage{}, value...), true
+	case string:
+		nj.JSON, nj.Valid = json.RawMessage(value), true
+	default:
+		return fmt.Errorf("cannot scan %T into NullJSON", value)
+	}
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (nj NullJSON) Value() (driver.Value, error) {
+	if !nj.Valid {
+		return nil, nil
+	}
+	return []byte(nj.JSON), nil
+}
+
+func (nj NullJSON) MarshalJSON() ([]byte, error) {
+	if nj.Valid {
+		return nj.JSON, nil
+	}
+	return json.Marshal(nil)
+}
+
+// snapshotOf returns the JSON of item, or null if there is no item
+func snapshotOf(item TableStruct) (NullJSON, error) {
+	if item == nil {
+		return NullJSON{}, nil
+	}
+	snapshot, err := json.Marshal(item)
+	if err != nil {
+		return NullJSON{}, internalError(err)
+	}
+	return NullJSON{JSON: snapshot, Valid: true}, nil
+}
+
+// audited runs write, an operation on the record item identifies, and appends it to the audit log.
+// Updates and deletes read the record before and after the write; creates log the record as given.
+// The actor is the authenticated caller, if any. The claimed actor is who the caller claims to be,
+// and otherwise the updated_by item was written with, if any.
+func audited(db Runner, caller Caller, operation string, item TableStruct, write func() error) error {
+
+	r, err := ResourceOf(item)
+	if err != nil {
+		return err
+	}
+	var before, after TableStruct
+	if operation != AuditCreate {
+		if before, err = getFromTable(db, r.WithID(r.IDOf(item))); err != nil {
+			return err
+		}
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	if operation == AuditCreate {
+		after = item
+	} else if after, err = getFromTable(db, r.WithID(r.IDOf(item))); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return appendAudit(db, caller, operation, item, before, after)
+}
+
+// auditedMany logs the creation of every one of items
+func auditedMany(db Runner, caller Caller, items []TableStruct) error {
+	for _, item := range items {
+		if err := appendAudit(db, caller, AuditCreate, item, nil, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditedPurge purges the records of the resource of item which have been in the trash since before,
+// and logs the purge of every one of them, along with the record as it was
+func auditedPurge(db Runner, caller Caller, item TableStruct, before time.Time) (int64, error) {
+
+	r, err := ResourceOf(item)
+	if err != nil {
+		return 0, err
+	}
+	trashed, err := trashedSince(db, r, before)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := item.PurgeFromDatabase(db, before)
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range trashed {
+		// The purge is logged for the record alone, as its updated_by tells who deleted it rather than who purged it
+		if err := appendAudit(db, caller, AuditPurge, r.WithID(r.IDOf(record)), record, nil); err != nil {
+			return 0, err
+		}
+	}
+	return purged, nil
+}
+
+func appendAudit(db Runner, caller Caller, operation string, item TableStruct, before, after TableStruct) error {
+
+	r, err := ResourceOf(item)
+	if err != nil {
+		return err
+	}
+	actor := NullString{String: caller.Actor, Valid: caller.Actor != ""}
+	claimed := NullString{String: caller.ClaimedActor, Valid: caller.ClaimedActor != ""}
+	if i := r.field("updated_by"); !claimed.Valid && i >= 0 {
+		claimed, _ = reflect.ValueOf(item).Field(i).Interface().(NullString)
+	}
+	beforeState, err := snapshotOf(before)
+	if err != nil {
+		return err
+	}
+	afterState, err := snapshotOf(after)
+	if err != nil {
+		return err
+	}
+	requestID := NullString{String: caller.RequestID, Valid: caller.RequestID != ""}
+	_, err = db.Exec(db.Rebind("INSERT INTO audit_log (actor, claimed_actor, resource, record_id, operation, before_state, after_state, request_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		actor, claimed, r.Name, r.IDOf(item), operation, beforeState, afterState, requestID, time.Now().UTC())
+	if err != nil {
+		return internalError(err)
+	}
+	return nil
+}
+
+// auditColumns lists the columns of the audit_log table, after the db tags of AuditEntry
+func auditColumns() []string {
+	t := reflect.TypeOf(AuditEntry{})
+	columns := make([]string, t.NumField())
+	for i := range columns {
+		columns[i] = t.Field(i).Tag.Get("db")
+	}
+	return columns
+}
+
+// listAudit returns a page of the entries matching q, newest first, along with how many there are
+// Entries are stamped in UTC, and the time range is taken in UTC as well, as SQLite compares times as text.
+func listAudit(db Runner, q AuditQuery) ([]AuditEntry, int, error) {
+
+	conditions, values := make([]string, 0), make([]interface{}, 0)
+	for _, f := range []struct{ column, value string }{{"actor", q.Actor}, {"claimed_actor", q.ClaimedActor}, {"resource", q.Resource}, {"record_id", q.RecordID}} {
+		if f.value != "" {
+			conditions = append(conditions, f.column+" = ?")
+			values = append(values, f.value)
+		}
+	}
+	if !q.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		values = append(values, q.Since.UTC())
+	}
+	if !q.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		values = append(values, q.Until.UTC())
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRow(db.Rebind("SELECT COUNT(*) FROM audit_log"+where), values...).Scan(&total); err != nil {
+		return nil, 0, internalError(err)
+	}
+	entries := []AuditEntry{}
+	query := "SELECT audit_id, actor, claimed_actor, resource, record_id, operation, before_state, after_state, request_id, created_at FROM audit_log" + where + " ORDER BY audit_id DESC LIMIT ? OFFSET ?"
+	if err := db.Select(&entries, db.Rebind(query), append(values, q.Limit, q.Offset)...); err != nil {
+		return nil, 0, internalError(err)
+	}
+	return entries, total, nil
+}
+
+// ListAudit returns a page of the audit log entries matching q, newest first, along with how many there are
+func (db *DB) ListAudit(q AuditQuery) (entries []AuditEntry, total int, err error) {
+	err = db.do(func() (err error) {
+		entries, total, err = listAudit(db, q)
+		return err
+	})
+	return entries, total, err
+}
+
+// As returns a Datastore whose writes are logged as made by caller
+func (db *DB) As(caller Caller) Datastore {
+	scoped := *db
+	scoped.caller = caller
+	return &scoped
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"errors"
+)
+
+// Operations of a bulk request
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// MaxBulkOperations caps the number of operations in a single bulk request
+const MaxBulkOperations = 1000
+
+// BulkOperation is one step of a bulk request, Op being one of BulkCreate, BulkUpdate and BulkDelete
+type BulkOperation struct {
+	Op   string
+	Item TableStruct
+}
+
+// AbortedError is reported for the operations of an all-or-nothing bulk request which were rolled back
+// or never run because another operation failed
+var AbortedError = NewError(ErrAborted, "Aborted By Another Operation", nil)
+
+// RunBulk executes ops on ds and returns the outcome of each of them, nil meaning success.
+// Consecutive creates are written together with multi-row INSERTs.
+// If atomic is set the operations share a transaction, and the first failure rolls back all of them.
+// Otherwise every operation stands on its own, and a failed batch of creates is retried one by one
+// so that each of them gets its own outcome. Likewise, if a batch of creates fails an atomic request,
+// the operations are replayed one by one in a transaction which is rolled back, to tell which of them failed.
+func RunBulk(ds Datastore, ops []BulkOperation, atomic bool) []error {
+
+	results := make([]error, len(ops))
+	if !atomic {
+		runBulk(ds, ops, results, true, true)
+		return results
+	}
+
+	err := ds.WithTx(func(tx Datastore) error {
+		for i := range results {
+			results[i] = nil
+		}
+		return runBulk(tx, ops, results, false, true)
+	})
+	// Only the creates of a batch fail together, as the first failure stops the others
+	if err != nil && failures(results) > 1 {
+		replayed := make([]error, len(ops))
+		ds.WithTx(func(tx Datastore) error {
+			for i := range replayed {
+				replayed[i] = nil
+			}
+			runBulk(tx, ops, replayed, false, false)
+			return errReplayed
+		})
+		if failures(replayed) > 0 {
+			copy(results, replayed)
+		}
+	}
+	if err != nil {
+		for i := range results {
+			if results[i] == nil {
+				results[i] = AbortedError
+			}
+		}
+		// The transaction itself failed, e.g. on commit
+		if !errors.Is(err, ErrAborted) && failures(results) == 0 {
+			for i := range results {
+				results[i] = err
+			}
+		}
+	}
+	return results
+}
+
+// errReplayed rolls back the replay of a failed atomic request
+var errReplayed = errors.New("Bulk Operations Replayed")
+
+// runBulk fills results with the outcome of every operation.
+// Unless it is told to carry on, it stops at the first failure and returns it.
+// Consecutive creates are written in batches if batch is set, and one by one otherwise.
+func runBulk(ds Datastore, ops []BulkOperation, results []error, carryOn bool, batch bool) error {
+
+	for start := 0; start < len(ops); {
+
+		// Gather the run of creates starting here
+		end := start
+		for batch && end < len(ops) && ops[end].Op == BulkCreate && sameResource(ops[start].Item, ops[end].Item) {
+			end++
+		}
+
+		if end > start {
+			items := make([]TableStruct, 0, end-start)
+			for _, op := range ops[start:end] {
+				items = append(items, op.Item)
+			}
+			err := ds.CreateMany(items)
+			if err != nil && carryOn {
+				for i := start; i < end; i++ {
+					_, results[i] = ds.Create(ops[i].Item)
+				}
+			} else {
+				for i := start; i < end; i++ {
+					results[i] = err
+				}
+			}
+			if err != nil && !carryOn {
+				return err
+			}
+			start = end
+			continue
+		}
+
+		var err error
+		switch ops[start].Op {
+		case BulkCreate:
+			_, err = ds.Create(ops[start].Item)
+		case BulkUpdate:
+			_, err = ds.Update(ops[start].Item)
+		case BulkDelete:
+			_, err = ds.Delete(ops[start].Item)
+		default:
+			err = NewError(ErrValidation, "Invalid Operation: "+ops[start].Op, nil)
+		}
+		results[start] = err
+		if err != nil && !carryOn {
+			return err
+		}
+		start++
+	}
+	return nil
+}
+
+func sameResource(a, b TableStruct) bool {
+	ra, errA := ResourceOf(a)
+	rb, errB := ResourceOf(b)
+	return errA == nil && errB == nil && ra.typ == rb.typ
+}
+
+// failures counts the operations which failed on their own account
+func failures(results []error) int {
+	n := 0
+	for _, err := range results {
+		if err != nil && !errors.Is(err, ErrAborted) {
+			n++
+		}
+	}
+	return n
+}
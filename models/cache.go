@@ -0,0 +1,360 @@
+package models
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cache stores records by key until their TTL is over or they are deleted.
+// LRU keeps them in process; a store shared between servers, e.g. Redis, can be plugged in by implementing Cache,
+// encoding the records of each resource as it sees fit: keys start with the name of the resource.
+type Cache interface {
+	Get(key string) (TableStruct, bool)
+	Set(key string, item TableStruct, ttl time.Duration)
+	Delete(key string)
+}
+
+// LRU is an in-process Cache of a fixed number of records, evicting the least recently used first.
+// It is safe for concurrent use.
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	// order holds the lruEntry of every key, the most recently used first
+	order *list.List
+}
+
+type lruEntry struct {
+	key     string
+	item    TableStruct
+	expires time.Time
+}
+
+// NewLRU returns an LRU holding up to capacity records
+func NewLRU(capacity int) *LRU {
+	return &LRU{capacity: capacity, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (c *LRU) Get(key string) (TableStruct, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(e)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return entry.item, true
+}
+
+func (c *LRU) Set(key string, item TableStruct, ttl time.Duration) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value = &lruEntry{key: key, item: item, expires: time.Now().Add(ttl)}
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, item: item, expires: time.Now().Add(ttl)})
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU) Delete(key string) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+}
+
+// Len returns the number of records held, expired or not
+func (c *LRU) Len() int {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *LRU) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*lruEntry).key)
+}
+
+// CacheTTLs is how long the records of each resource, by name, stay cached.
+// The records of resources without a TTL are not cached.
+type CacheTTLs map[string]time.Duration
+
+// NewCachedDatastore returns a Datastore reading records through cache before ds.
+// The records written through it are evicted from the cache, and purges evict every record of the resource.
+// Concurrent gets of a record missing from the cache are coalesced into a single read of ds.
+// Writes made by other servers, or straight to ds, are seen once the TTL is over,
+// and so are the writes a lagging replica hasn't caught up with when the record is read again.
+// Callers which read their writes from the primary of a DB, see DB.StickyWindow, skip the cache,
+// and what they read is cached in place of what was, so that their own writes aren't hidden by a stale record.
+// Lists, revisions and the audit log are never cached.
+func NewCachedDatastore(ds Datastore, cache Cache, ttls CacheTTLs) Datastore {
+	return cachedDB{Datastore: ds, readThrough: &readThrough{cache: cache, ttls: ttls, loads: make(map[string]*load), generations: make(map[string]uint64)}}
+}
+
+// readThrough is what the copies of a cachedDB made by IfMatch and As share
+type readThrough struct {
+	cache Cache
+	ttls  CacheTTLs
+
+	mu    sync.Mutex
+	loads map[string]*load
+	// generations is bumped on every purge of a resource, which leaves the keys of the records cached before behind
+	generations map[string]uint64
+}
+
+// load is a read of a record in flight, which the gets of the same record wait for
+type load struct {
+	done chan struct{}
+	item TableStruct
+	err  error
+	// stale is set if the record is written while it is read, so that what is read isn't cached
+	stale bool
+}
+
+// key returns the key of item in the cache, and whether its resource is cached at all
+func (rt *readThrough) key(item TableStruct) (string, time.Duration, bool) {
+
+	r, err := ResourceOf(item)
+	if err != nil || rt.ttls[r.Name] <= 0 {
+		return "", 0, false
+	}
+	rt.mu.Lock()
+	generation := rt.generations[r.Name]
+	rt.mu.Unlock()
+	return r.Name + ":" + strconv.FormatUint(generation, 10) + ":" + r.IDOf(item), rt.ttls[r.Name], true
+}
+
+// load reads the record at key with get and caches it, unless a read of it is in flight already
+func (rt *readThrough) load(key string, ttl time.Duration, get func() (TableStruct, error)) (TableStruct, error) {
+
+	rt.mu.Lock()
+	if l, ok := rt.loads[key]; ok {
+		rt.mu.Unlock()
+		<-l.done
+		return l.item, l.err
+	}
+	l := &load{done: make(chan struct{})}
+	rt.loads[key] = l
+	rt.mu.Unlock()
+
+	return rt.finish(key, ttl, l, get)
+}
+
+// refresh reads the record at key with get, whatever is cached or in flight, and caches it in their place
+func (rt *readThrough) refresh(key string, ttl time.Duration, get func() (TableStruct, error)) (TableStruct, error) {
+
+	rt.mu.Lock()
+	if l, ok := rt.loads[key]; ok {
+		l.stale = true
+	}
+	rt.cache.Delete(key)
+	l := &load{done: make(chan struct{})}
+	rt.loads[key] = l
+	rt.mu.Unlock()
+
+	return rt.finish(key, ttl, l, get)
+}
+
+// finish runs the load l of the record at key, and caches what it reads unless it went stale meanwhile
+func (rt *readThrough) finish(key string, ttl time.Duration, l *load, get func() (TableStruct, error)) (TableStruct, error) {
+
+	l.item, l.err = get()
+
+	rt.mu.Lock()
+	if l.err == nil && !l.stale {
+		rt.cache.Set(key, l.item, ttl)
+	}
+	if rt.loads[key] == l {
+		delete(rt.loads, key)
+	}
+	rt.mu.Unlock()
+	close(l.done)
+	return l.item, l.err
+}
+
+// evict drops item from the cache, and keeps the reads of it in flight from caching what they read
+func (rt *readThrough) evict(item TableStruct) {
+
+	key, _, ok := rt.key(item)
+	if !ok {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if l, ok := rt.loads[key]; ok {
+		l.stale = true
+		delete(rt.loads, key)
+	}
+	rt.cache.Delete(key)
+}
+
+// evictAll drops every record of the resource of item from the cache
+func (rt *readThrough) evictAll(item TableStruct) {
+	if r, err := ResourceOf(item); err == nil {
+		rt.mu.Lock()
+		rt.generations[r.Name]++
+		rt.mu.Unlock()
+	}
+}
+
+// cachedDB is the Datastore returned by NewCachedDatastore
+type cachedDB struct {
+	Datastore
+	*readThrough
+}
+
+// stickyReader is implemented by the Datastores whose caller may read its writes from the primary, see DB
+type stickyReader interface {
+	sticky() bool
+}
+
+func (c cachedDB) Get(item TableStruct) (TableStruct, error) {
+
+	key, ttl, ok := c.key(item)
+	if !ok {
+		return c.Datastore.Get(item)
+	}
+	get := func() (TableStruct, error) { return c.Datastore.Get(item) }
+	if s, ok := c.Datastore.(stickyReader); ok && s.sticky() {
+		return c.refresh(key, ttl, get)
+	}
+	if cached, ok := c.cache.Get(key); ok {
+		return cached, nil
+	}
+	return c.load(key, ttl, get)
+}
+
+func (c cachedDB) Create(item TableStruct) (interface{}, error) {
+	defer c.evict(item)
+	return c.Datastore.Create(item)
+}
+
+func (c cachedDB) CreateMany(items []TableStruct) error {
+	defer func() {
+		for _, item := range items {
+			c.evict(item)
+		}
+	}()
+	return c.Datastore.CreateMany(items)
+}
+
+func (c cachedDB) Update(item TableStruct) (interface{}, error) {
+	defer c.evict(item)
+	return c.Datastore.Update(item)
+}
+
+func (c cachedDB) Replace(item TableStruct) (interface{}, error) {
+	defer c.evict(item)
+	return c.Datastore.Replace(item)
+}
+
+func (c cachedDB) Delete(item TableStruct) (interface{}, error) {
+	defer c.evict(item)
+	return c.Datastore.Delete(item)
+}
+
+func (c cachedDB) Purge(item TableStruct, before time.Time) (int64, error) {
+	defer c.evictAll(item)
+	return c.Datastore.Purge(item, before)
+}
+
+// WithTx evicts the records written by fn once the transaction is over, so that they are read again once committed.
+// Gets made by fn are read in the transaction rather than from the cache.
+func (c cachedDB) WithTx(fn func(Datastore) error) error {
+	var evictions []func()
+	defer func() {
+		for _, evict := range evictions {
+			evict()
+		}
+	}()
+	return c.Datastore.WithTx(func(tx Datastore) error {
+		return fn(cachedTx{Datastore: tx, readThrough: c.readThrough, evictions: &evictions})
+	})
+}
+
+func (c cachedDB) IfMatch(versions ...time.Time) Datastore {
+	return cachedDB{Datastore: c.Datastore.IfMatch(versions...), readThrough: c.readThrough}
+}
+
+func (c cachedDB) As(caller Caller) Datastore {
+	return cachedDB{Datastore: c.Datastore.As(caller), readThrough: c.readThrough}
+}
+
+// cachedTx is the Datastore handed to the WithTx callbacks of a cachedDB.
+// It queues the evictions of what it writes until the transaction is over.
+type cachedTx struct {
+	Datastore
+	*readThrough
+	evictions *[]func()
+}
+
+func (t cachedTx) evictLater(items ...TableStruct) {
+	for _, item := range items {
+		item := item
+		*t.evictions = append(*t.evictions, func() { t.evict(item) })
+	}
+}
+
+func (t cachedTx) Create(item TableStruct) (interface{}, error) {
+	t.evictLater(item)
+	return t.Datastore.Create(item)
+}
+
+func (t cachedTx) CreateMany(items []TableStruct) error {
+	t.evictLater(items...)
+	return t.Datastore.CreateMany(items)
+}
+
+func (t cachedTx) Update(item TableStruct) (interface{}, error) {
+	t.evictLater(item)
+	return t.Datastore.Update(item)
+}
+
+func (t cachedTx) Replace(item TableStruct) (interface{}, error) {
+	t.evictLater(item)
+	return t.Datastore.Replace(item)
+}
+
+func (t cachedTx) Delete(item TableStruct) (interface{}, error) {
+	t.evictLater(item)
+	return t.Datastore.Delete(item)
+}
+
+func (t cachedTx) Purge(item TableStruct, before time.Time) (int64, error) {
+	*t.evictions = append(*t.evictions, func() { t.evictAll(item) })
+	return t.Datastore.Purge(item, before)
+}
+
+func (t cachedTx) WithTx(fn func(Datastore) error) error {
+	return t.Datastore.WithTx(func(tx Datastore) error {
+		return fn(cachedTx{Datastore: tx, readThrough: t.readThrough, evictions: t.evictions})
+	})
+}
+
+func (t cachedTx) IfMatch(versions ...time.Time) Datastore {
+	return cachedTx{Datastore: t.Datastore.IfMatch(versions...), readThrough: t.readThrough, evictions: t.evictions}
+}
+
+func (t cachedTx) As(caller Caller) Datastore {
+	return cachedTx{Datastore: t.Datastore.As(caller), readThrough: t.readThrough, evictions: t.evictions}
+}
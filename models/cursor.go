@@ -0,0 +1,160 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor marks the position of a row in a sorted list.
+// It holds the sort keys the list was ordered by, the primary key included,
+// and the values of those keys on the row.
+// A Before cursor pages towards the start of the list instead of the end.
+type Cursor struct {
+	Sorts  []Sort
+	Values []interface{}
+	Before bool
+}
+
+// cursorToken is the wire format of a cursor, encoded as base64 JSON.
+// Values are kept as strings so that they could be converted back with the column kinds.
+type cursorToken struct {
+	Keys   []string  `json:"k"`
+	Values []*string `json:"v"`
+	Before bool      `json:"b,omitempty"`
+}
+
+var errInvalidCursor = NewError(ErrValidation, "Invalid Cursor", nil)
+
+// ParseCursor decodes an opaque cursor token issued by a previous list request on item
+func ParseCursor(item interface{}, token string) (*Cursor, error) {
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	t := cursorToken{}
+	if err = json.Unmarshal(raw, &t); err != nil || len(t.Keys) == 0 || len(t.Keys) != len(t.Values) {
+		return nil, errInvalidCursor
+	}
+
+	columns := columnsOf(item)
+	cursor := &Cursor{Before: t.Before}
+	for i, key := range t.Keys {
+		s := Sort{Column: strings.TrimPrefix(key, "-"), Desc: strings.HasPrefix(key, "-")}
+		col, ok := columns[s.Column]
+		if !ok || col.name != s.Column {
+			return nil, errInvalidCursor
+		}
+		var value interface{}
+		if t.Values[i] != nil {
+			if value, err = col.parse(*t.Values[i]); err != nil {
+				return nil, errInvalidCursor
+			}
+		}
+		cursor.Sorts = append(cursor.Sorts, s)
+		cursor.Values = append(cursor.Values, value)
+	}
+	return cursor, nil
+}
+
+// encodeCursor issues the token pointing at row, a struct with db tags
+func encodeCursor(row interface{}, sorts []Sort, before bool) string {
+
+	t := cursorToken{Before: before}
+	v := reflect.ValueOf(row)
+	for _, s := range sorts {
+		key := s.Column
+		if s.Desc {
+			key = "-" + key
+		}
+		t.Keys = append(t.Keys, key)
+		t.Values = append(t.Values, formatColumn(v, s.Column))
+	}
+	raw, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// formatColumn renders the field tagged with column as a string, or nil if it is NULL
+func formatColumn(v reflect.Value, column string) *string {
+
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("db") != column {
+			continue
+		}
+		var s string
+		switch field := v.Field(i).Interface().(type) {
+		case string:
+			s = field
+		case int:
+			s = strconv.Itoa(field)
+		case bool:
+			s = strconv.FormatBool(field)
+		case NullInt:
+			if !field.Valid {
+				return nil
+			}
+			s = strconv.FormatInt(field.Int, 10)
+		case NullBool:
+			if !field.Valid {
+				return nil
+			}
+			s = strconv.FormatBool(field.Bool)
+		case NullString:
+			if !field.Valid {
+				return nil
+			}
+			s = field.String
+		case NullTime:
+			if !field.Valid {
+				return nil
+			}
+			s = field.Time.Format(time.RFC3339Nano)
+		default:
+			return nil
+		}
+		return &s
+	}
+	return nil
+}
+
+// keysetClause renders the condition selecting rows past the cursor, in the direction the cursor points to.
+// NULL is the smallest value in MySQL, so it comes first in ascending order and last in descending order.
+func (cursor *Cursor) keysetClause() (string, []interface{}) {
+
+	conditions := make([]string, 0, len(cursor.Sorts))
+	values := make([]interface{}, 0)
+	for i, s := range cursor.Sorts {
+
+		equals := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			if cursor.Values[j] == nil {
+				equals = append(equals, fmt.Sprintf("%s IS NULL", cursor.Sorts[j].Column))
+			} else {
+				equals = append(equals, fmt.Sprintf("%s = ?", cursor.Sorts[j].Column))
+				values = append(values, cursor.Values[j])
+			}
+		}
+
+		// Paging backwards walks the list in the reversed order
+		desc := s.Desc != cursor.Before
+		switch value := cursor.Values[i]; {
+		case value == nil && desc:
+			equals = append(equals, "1 = 0")
+		case value == nil:
+			equals = append(equals, fmt.Sprintf("%s IS NOT NULL", s.Column))
+		case desc:
+			equals = append(equals, fmt.Sprintf("(%s < ? OR %s IS NULL)", s.Column, s.Column))
+			values = append(values, value)
+		default:
+			equals = append(equals, fmt.Sprintf("%s > ?", s.Column))
+			values = append(values, value)
+		}
+		conditions = append(conditions, "("+strings.Join(equals, " AND ")+")")
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", values
+}
@@ -5,7 +5,6 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -20,9 +19,15 @@ import (
 
 // ------------------------------  NULLABLE TYPE DEFINITION -----------------------------
 
+// The nullable types below are tri-state when decoded from JSON.
+// A field absent from the JSON body is left neither Valid nor set,
+// while an explicit null marks it set but not Valid.
+// Partial updates use this to leave absent fields untouched and to write NULL for explicit nulls.
+
 type NullTime struct {
 	Time  time.Time
 	Valid bool
+	set   bool
 }
 
 func (nt *NullTime) Scan(value interface{}) error {
@@ -46,7 +51,7 @@ func (nt NullTime) MarshalJSON() ([]byte, error) {
 }
 
 func (nt *NullTime) UnmarshalJSON(text []byte) error {
-	nt.Valid = false
+	nt.Valid, nt.set = false, true
 	txt := string(text)
 	if txt == "null" || txt == "" {
 		return nil
@@ -63,7 +68,11 @@ func (nt *NullTime) UnmarshalJSON(text []byte) error {
 }
 
 // Create our own null string type for prettier marshal JSON format
-type NullString sql.NullString
+type NullString struct {
+	String string
+	Valid  bool
+	set    bool
+}
 
 // Scan is currently a wrap of sql.NullString.Scan()
 func (ns *NullString) Scan(value interface{}) error {
@@ -92,7 +101,7 @@ func (ns NullString) MarshalJSON() ([]byte, error) {
 }
 
 func (ns *NullString) UnmarshalJSON(text []byte) error {
-	ns.Valid = false
+	ns.Valid, ns.set = false, true
 	if string(text) == "null" {
 		return nil
 	}
@@ -102,24 +111,157 @@ func (ns *NullString) UnmarshalJSON(text []byte) error {
 	return nil
 }
 
+// NullInt is a nullable int, scanned with sql.NullInt64
+type NullInt struct {
+	Int   int64
+	Valid bool
+	set   bool
+}
+
+func (ni *NullInt) Scan(value interface{}) error {
+	x := sql.NullInt64{}
+	err := x.Scan(value)
+	ni.Int, ni.Valid = x.Int64, x.Valid
+	return err
+}
+
+// Value implements the driver Valuer interface.
+func (ni NullInt) Value() (driver.Value, error) {
+	if !ni.Valid {
+		return nil, nil
+	}
+	return ni.Int, nil
+}
+
+func (ni NullInt) MarshalJSON() ([]byte, error) {
+	if ni.Valid {
+		return json.Marshal(ni.Int)
+	}
+	return json.Marshal(nil)
+}
+
+func (ni *NullInt) UnmarshalJSON(text []byte) error {
+	ni.Valid, ni.set = false, true
+	if string(text) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(text, &ni.Int); err != nil {
+		return err
+	}
+	ni.Valid = true
+	return nil
+}
+
+// NullBool is a nullable bool, scanned with sql.NullBool so that tinyint columns work as well
+type NullBool struct {
+	Bool  bool
+	Valid bool
+	set   bool
+}
+
+func (nb *NullBool) Scan(value interface{}) error {
+	x := sql.NullBool{}
+	err := x.Scan(value)
+	nb.Bool, nb.Valid = x.Bool, x.Valid
+	return err
+}
+
+// Value implements the driver Valuer interface.
+func (nb NullBool) Value() (driver.Value, error) {
+	if !nb.Valid {
+		return nil, nil
+	}
+	return nb.Bool, nil
+}
+
+func (nb NullBool) MarshalJSON() ([]byte, error) {
+	if nb.Valid {
+		return json.Marshal(nb.Bool)
+	}
+	return json.Marshal(nil)
+}
+
+func (nb *NullBool) UnmarshalJSON(text []byte) error {
+	nb.Valid, nb.set = false, true
+	if string(text) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(text, &nb.Bool); err != nil {
+		return err
+	}
+	nb.Valid = true
+	return nil
+}
+
+// present reports whether field, one of the nullable types, was either given a value or explicitly set to null.
+// The second result is false for types which don't track presence.
+func present(field interface{}) (isPresent bool, tracked bool) {
+	switch field := field.(type) {
+	case NullString:
+		return field.Valid || field.set, true
+	case NullTime:
+		return field.Valid || field.set, true
+	case NullInt:
+		return field.Valid || field.set, true
+	case NullBool:
+		return field.Valid || field.set, true
+	}
+	return false, false
+}
+
 // ----------------------------- END OF NULLABLE TYPE DEFINITION -----------------------------
 
 type Datastore interface {
 	Get(item TableStruct) (TableStruct, error)
 	Create(item TableStruct) (interface{}, error)
+	CreateMany(items []TableStruct) error
 	Update(item TableStruct) (interface{}, error)
+	Replace(item TableStruct) (interface{}, error)
 	Delete(item TableStruct) (interface{}, error)
+	List(item TableStruct, args ListArgs) (ListResult, error)
+	Purge(item TableStruct, before time.Time) (int64, error)
+	ListRevisions(item TableStruct, limit int, offset int) ([]Revision, int, error)
+	GetRevision(item TableStruct, number int64) (Revision, error)
+	GetPreviousRevision(item TableStruct, number int64) (Revision, error)
+	ListAudit(q AuditQuery) ([]AuditEntry, int, error)
+	WithTx(fn func(Datastore) error) error
+	IfMatch(versions ...time.Time) Datastore
+	As(caller Caller) Datastore
 }
 
+// DB is the SQL Datastore, running on MySQL, PostgreSQL or, for local development, on SQLite.
+// If Audit is set, every write is logged in the audit_log table along with it, see AuditEntry.
+// Gets and lists are read from the replicas, if any, except for StickyWindow after the caller writes.
 type DB struct {
 	*sqlx.DB
+	Retry        RetryPolicy
+	Breaker      *CircuitBreaker
+	Audit        bool
+	StickyWindow time.Duration
+
+	// ifMatch holds the versions set by IfMatch, and caller the one set by As
+	ifMatch  []time.Time
+	caller   Caller
+	replicas *replicaSet
+}
+
+// Runner is what TableStruct methods run their queries on.
+// Both *DB and *sqlx.Tx implement it, so that the methods could take part in a transaction.
+type Runner interface {
+	sqlx.Ext
+	QueryRow(query string, args ...interface{}) *sql.Row
+	NamedExec(query string, arg interface{}) (sql.Result, error)
+	Select(dest interface{}, query string, args ...interface{}) error
 }
 
 type TableStruct interface {
-	GetFromDatabase(*DB) (TableStruct, error)
-	InsertIntoDatabase(*DB) error
-	UpdateDatabase(*DB) error
-	DeleteFromDatabase(*DB) error
+	GetFromDatabase(Runner) (TableStruct, error)
+	InsertIntoDatabase(Runner) error
+	UpdateDatabase(Runner) error
+	ReplaceInDatabase(Runner) error
+	DeleteFromDatabase(Runner) error
+	ListFromDatabase(Runner, ListArgs) (ListResult, error)
+	PurgeFromDatabase(Runner, time.Time) (int64, error)
 }
 
 // func InitDB(dataURI string) {
@@ -133,100 +275,163 @@ type TableStruct interface {
 // 	}
 // }
 
-func NewDB(dbURI string) (*DB, error) {
-	db, err := sqlx.Open("mysql", dbURI)
+// NewDB connects to the primary database at dbURI with driver, one of mysql, postgres or sqlite3,
+// and to its read replicas at replicaURIs, if any.
+// A SQLite database is kept to a single connection, which serializes the writes it only allows one at a time
+// and lets in-memory databases, which live and die with their connection, be shared.
+// Replicas which can't be reached yet are left out of the rotation until they pass a health check.
+func NewDB(driver string, dbURI string, replicaURIs ...string) (*DB, error) {
+	if _, ok := dialects[driver]; !ok {
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+	open := func(uri string) (*sqlx.DB, error) {
+		db, err := sqlx.Open(driver, uri)
+		if err == nil && driver == "sqlite3" {
+			db.SetMaxOpenConns(1)
+		}
+		return db, err
+	}
+	db, err := open(dbURI)
 	if err != nil {
 		return nil, err
 	}
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
-	return &DB{db}, nil
+	ds := &DB{DB: db, Retry: DefaultRetryPolicy, Breaker: NewCircuitBreaker(5, 10*time.Second), Audit: true, StickyWindow: DefaultStickyWindow}
+	if len(replicaURIs) > 0 {
+		replicas := make([]*sqlx.DB, 0, len(replicaURIs))
+		for _, uri := range replicaURIs {
+			replica, err := open(uri)
+			if err != nil {
+				return nil, err
+			}
+			replicas = append(replicas, replica)
+		}
+		ds.replicas = newReplicaSet(replicas)
+	}
+	return ds, nil
 }
 
-// Get implemented for Datastore interface below
+// Get implemented for Datastore interface below.
+// Every method dispatches to the TableStruct methods of a registered resource,
+// and fails for types which were never registered.
 func (db *DB) Get(item TableStruct) (TableStruct, error) {
 
-	// Declaration of return set
-	var (
-		result TableStruct
-		err    error
-	)
-
-	switch item := item.(type) {
-	case Member:
-		result, err = item.GetFromDatabase(db)
-		if err != nil {
-			result = Member{}
-		}
-	case Article:
-		result, err = item.GetFromDatabase(db)
-		if err != nil {
-			result = Article{}
-		}
+	var result TableStruct
+	if _, err := ResourceOf(item); err != nil {
+		return nil, err
+	}
+	err := db.read(func(reader Runner) (err error) {
+		result, err = item.GetFromDatabase(reader)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return result, err
+	return result, nil
 }
 
 func (db *DB) Create(item TableStruct) (interface{}, error) {
 
-	var (
-		result TableStruct
-		err    error
-	)
-	switch item := item.(type) {
-	case Member:
-		err = item.InsertIntoDatabase(db)
-	case Article:
-		err = item.InsertIntoDatabase(db)
-	default:
-		err = errors.New("Insert fail")
+	if _, err := ResourceOf(item); err != nil {
+		return nil, err
+	}
+	err := db.WithTx(func(ds Datastore) error {
+		_, err := ds.Create(item)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return result, err
+	return item, nil
 }
 
+// CreateMany inserts records of one resource with multi-row INSERTs.
+// Either all of them are written or none, unless called in a transaction which goes on after a failure.
+func (db *DB) CreateMany(items []TableStruct) error {
+	return db.WithTx(func(ds Datastore) error { return ds.CreateMany(items) })
+}
+
+// Update writes the fields set on item.
+// Writes run in a transaction of their own, so that revisions and audit entries are recorded along with them.
 func (db *DB) Update(item TableStruct) (interface{}, error) {
 
-	var (
-		result TableStruct
-		err    error
-	)
-	switch item := item.(type) {
-	case Member:
-		err = item.UpdateDatabase(db)
-	case Article:
-		err = item.UpdateDatabase(db)
-	default:
-		err = errors.New("Update Fail")
+	if _, err := ResourceOf(item); err != nil {
+		return nil, err
 	}
-	return result, err
+	err := db.WithTx(func(ds Datastore) error {
+		_, err := ds.Update(item)
+		return err
+	})
+	return nil, err
+}
+
+// Replace overwrites every writable column of the stored record with item, and returns the record as stored
+func (db *DB) Replace(item TableStruct) (interface{}, error) {
+
+	if _, err := ResourceOf(item); err != nil {
+		return nil, err
+	}
+	var result interface{}
+	err := db.WithTx(func(ds Datastore) (err error) {
+		result, err = ds.Replace(item)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 func (db *DB) Delete(item TableStruct) (interface{}, error) {
 
-	var (
-		result TableStruct
-		err    error
-	)
-	switch item := item.(type) {
-	case Member:
-		err = item.DeleteFromDatabase(db)
-		if err != nil {
-			result = Member{}
-		} else {
-			result = item
-		}
-	case Article:
-		err = item.DeleteFromDatabase(db)
-		if err != nil {
-			result = Article{}
-		} else {
-			result = item
-		}
+	if _, err := ResourceOf(item); err != nil {
+		return nil, err
 	}
-	return result, err
+	err := db.WithTx(func(ds Datastore) error {
+		_, err := ds.Delete(item)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
 }
 
+// List returns a page of records of the same type as item
+func (db *DB) List(item TableStruct, args ListArgs) (ListResult, error) {
+
+	result := ListResult{Items: []TableStruct{}}
+	if _, err := ResourceOf(item); err != nil {
+		return result, err
+	}
+	err := db.read(func(reader Runner) (err error) {
+		result, err = item.ListFromDatabase(reader, args)
+		return err
+	})
+	if err != nil {
+		return ListResult{Items: []TableStruct{}}, err
+	}
+	return result, nil
+}
+
+// Purge deletes for real the records of the same type as item which have been in the trash since before.
+// Every record purged is logged in the audit log, unless auditing is off.
+func (db *DB) Purge(item TableStruct, before time.Time) (int64, error) {
+
+	var purged int64
+	if _, err := ResourceOf(item); err != nil {
+		return 0, err
+	}
+	err := db.WithTx(func(ds Datastore) (err error) {
+		purged, err = ds.Purge(item, before)
+		return err
+	})
+	return purged, err
+}
+
+// generateSQLStmt builds the named query writing input to tableName
 func generateSQLStmt(input interface{}, mode string, tableName string) (query string, err error) {
 
 	columns := make([]string, 0)
@@ -239,6 +444,10 @@ func generateSQLStmt(input interface{}, mode string, tableName string) (query st
 	case "insert":
 		fmt.Println("insert")
 		for i := 0; i < u.NumField(); i++ {
+			// Absent fields are left to the column defaults
+			if isPresent, tracked := present(u.Field(i).Interface()); tracked && !isPresent {
+				continue
+			}
 			tag := u.Type().Field(i).Tag.Get("db")
 			columns = append(columns, tag)
 		}
@@ -258,11 +467,16 @@ func generateSQLStmt(input interface{}, mode string, tableName string) (query st
 		var idName string
 		for i := 0; i < u.NumField(); i++ {
 			tag := u.Type().Field(i).Tag
-			columns = append(columns, tag.Get("db"))
 
 			if tag.Get("json") == "id" {
 				idName = tag.Get("db")
 			}
+			// Leave alone the columns clients can't send, the creation time which never changes,
+			// and the active flag, which only deletes, restores and publishes change
+			if tag.Get("json") == "-" || tag.Get("db") == "create_time" || tag.Get("db") == activeColumn {
+				continue
+			}
+			columns = append(columns, tag.Get("db"))
 		}
 
 		temp := make([]string, len(columns))
@@ -294,14 +508,9 @@ func generateSQLStmt(input interface{}, mode string, tableName string) (query st
 					}
 					columns = append(columns, tag.Get("db"))
 				}
-			case NullString:
-				if field.Valid {
-					fmt.Println("valid NullString : ", field.String)
-					columns = append(columns, tag.Get("db"))
-				}
-			case NullTime:
-				if field.Valid {
-					fmt.Println("valid NullTime : ", field.Time)
+			case NullString, NullTime, NullInt, NullBool:
+				// Explicit nulls are written as well, to clear the column
+				if isPresent, _ := present(field); isPresent {
 					columns = append(columns, tag.Get("db"))
 				}
 
@@ -318,7 +527,8 @@ func generateSQLStmt(input interface{}, mode string, tableName string) (query st
 		}
 		bytequery.WriteString(fmt.Sprintf("UPDATE %s SET ", tableName))
 		bytequery.WriteString(strings.Join(temp, ", "))
-		bytequery.WriteString(fmt.Sprintf(" WHERE %s = :%s;", idName, idName))
+		bytequery.WriteString(fmt.Sprintf(" WHERE %s = :%s", idName, idName))
+		bytequery.WriteString(";")
 
 		query = bytequery.String()
 		err = nil
@@ -0,0 +1,665 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestPartialUpdateOnlyWritesPresentFields(t *testing.T) {
+
+	article := Article{}
+	if err := json.Unmarshal([]byte(`{"id": "3345678", "title": "數讀政治獻金", "og_image": null}`), &article); err != nil {
+		t.Fatal(err)
+	}
+	query, err := generateSQLStmt(article, "partial_update", "article_infos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// like_amount and active are absent, so they must not be reset to 0, while og_image is cleared
+	expected := "UPDATE article_infos SET post_id = :post_id, title = :title, og_image = :og_image WHERE post_id = :post_id;"
+	if query != expected {
+		t.Errorf("Expected %s, got %s", expected, query)
+	}
+	if value, _ := article.OgImage.Value(); value != nil {
+		t.Errorf("Expected og_image to be written as NULL, got %v", value)
+	}
+}
+
+func TestPartialUpdateWritesValuesSetInCode(t *testing.T) {
+
+	member := Member{ID: "TaiwanNo.1", Active: NullBool{Bool: false, Valid: true}}
+	query, err := generateSQLStmt(member, "partial_update", "members")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "UPDATE members SET user_id = :user_id, active = :active WHERE user_id = :user_id;"
+	if query != expected {
+		t.Errorf("Expected %s, got %s", expected, query)
+	}
+}
+
+func TestInsertLeavesAbsentFieldsToDefaults(t *testing.T) {
+
+	member := Member{}
+	if err := json.Unmarshal([]byte(`{"id": "spaceoddity", "name": "Major Tom", "description": null}`), &member); err != nil {
+		t.Fatal(err)
+	}
+	query, err := generateSQLStmt(member, "insert", "members")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "INSERT INTO members (user_id,name,description) VALUES ( :user_id,:name,:description);"
+	if query != expected {
+		t.Errorf("Expected %s, got %s", expected, query)
+	}
+}
+
+func TestEveryWriteMovesTheVersion(t *testing.T) {
+
+	db, err := NewMemoryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	r, _ := ResourceOf(Article{})
+	if _, err := db.Create(r.PrepareCreate(Article{ID: "9527", Title: NullString{String: "數讀政治獻金", Valid: true}})); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := db.Get(Article{ID: "9527"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, _ := r.Version(stored)
+
+	// Both writes are made within the second the article was created in, and only the first one is fresh
+	update := r.PrepareUpdate(Article{ID: "9527", Title: NullString{String: "台北不是我的家", Valid: true}})
+	if _, err := db.IfMatch(version).Update(update); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.IfMatch(version).Update(update); !errors.Is(err, ErrConcurrency) {
+		t.Errorf("Expected the stale write to fail, got %v", err)
+	}
+	if _, err := db.IfMatch(version).Delete(Article{ID: "9527"}); !errors.Is(err, ErrConcurrency) {
+		t.Errorf("Expected the stale delete to fail, got %v", err)
+	}
+	if _, err := db.IfMatch(version).Update(Article{ID: "5566"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a missing article to be told apart, got %v", err)
+	}
+}
+
+func TestETagsParseToUTCVersions(t *testing.T) {
+
+	r, err := ResourceOf(Article{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	taipei := time.FixedZone("Asia/Taipei", 8*60*60)
+	version := time.Date(2026, 10, 17, 8, 0, 0, 0, taipei)
+	versions, err := ParseETags(r.ETag(Article{ID: "9527", UpdatedAt: NullTime{Time: version, Valid: true}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SQLite compares the offsets of times as well, so versions have to be bound in the zone they are stamped in
+	if len(versions) != 1 || versions[0].Location() != time.UTC || !versions[0].Equal(version) || stamp().Location() != time.UTC {
+		t.Errorf("Expected the version in UTC, got %v", versions)
+	}
+}
+
+func TestMigrationsArePairedAndContiguous(t *testing.T) {
+
+	versions := -1
+	for driver := range dialects {
+		migrations, err := Migrations(driver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("Expected embedded migrations for %s", driver)
+		}
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("Expected %s migration %d, got %d_%s", driver, i+1, m.Version, m.Name)
+			}
+			if len(statements(m.Up)) == 0 || len(statements(m.Down)) == 0 {
+				t.Errorf("Expected statements both ways in %s %d_%s", driver, m.Version, m.Name)
+			}
+		}
+		// Every driver must build the same schema
+		if versions >= 0 && len(migrations) != versions {
+			t.Errorf("Expected %d migrations for %s, got %d", versions, driver, len(migrations))
+		}
+		versions = len(migrations)
+	}
+}
+
+func TestStatementsSplitOnTrailingSemicolons(t *testing.T) {
+
+	stmts := statements("-- a comment\nCREATE TABLE a (\n    id INT\n);\n\nDROP TABLE b;\n")
+	expected := []string{"CREATE TABLE a (\n    id INT\n)", "DROP TABLE b"}
+	if len(stmts) != len(expected) {
+		t.Fatalf("Expected %q, got %q", expected, stmts)
+	}
+	for i := range expected {
+		if stmts[i] != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], stmts[i])
+		}
+	}
+}
+
+func TestCompareColumnsReportsMissingAndUnknown(t *testing.T) {
+
+	r, err := ResourceOf(Article{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := append([]string{"legacy_flag"}, r.Columns()[1:]...)
+	mismatch := compareColumns(r, columns)
+	if len(mismatch.Missing) != 1 || mismatch.Missing[0] != "post_id" {
+		t.Errorf("Expected post_id to be missing, got %v", mismatch.Missing)
+	}
+	if len(mismatch.Unknown) != 1 || mismatch.Unknown[0] != "legacy_flag" {
+		t.Errorf("Expected legacy_flag to be unknown, got %v", mismatch.Unknown)
+	}
+	if !mismatch.Breaking() {
+		t.Error("Expected a missing column to be breaking")
+	}
+	if m := compareColumns(r, r.Columns()); m.Breaking() || len(m.Unknown) > 0 {
+		t.Errorf("Expected no mismatch, got %s", m)
+	}
+}
+
+func TestDialectsDetectDuplicateKeys(t *testing.T) {
+
+	duplicates := map[string]error{
+		"mysql":    &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '9527' for key 'PRIMARY'"},
+		"postgres": &pq.Error{Code: "23505"},
+		"sqlite3":  sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintPrimaryKey},
+	}
+	for driver, err := range duplicates {
+		if !dialects[driver].isDuplicate(err) {
+			t.Errorf("Expected %s to detect %v as a duplicate", driver, err)
+		}
+		if dialects[driver].isDuplicate(errors.New("Duplicate entry")) {
+			t.Errorf("Expected %s to only detect its own errors", driver)
+		}
+	}
+}
+
+func TestOrderClauseSortsNullsFirst(t *testing.T) {
+
+	keys := []Sort{{Column: "like_amount", Desc: true}, {Column: "post_id"}}
+	if clause := orderClause(keys, false, dialects["mysql"]); clause != " ORDER BY like_amount DESC, post_id ASC" {
+		t.Errorf("Unexpected MySQL order: %s", clause)
+	}
+	expected := " ORDER BY like_amount ASC NULLS FIRST, post_id DESC NULLS LAST"
+	if clause := orderClause(keys, true, dialects["postgres"]); clause != expected {
+		t.Errorf("Expected %s, got %s", expected, clause)
+	}
+}
+
+func TestReadsGoToReplicasUnlessTheClientJustWrote(t *testing.T) {
+
+	// Two in-memory databases, which share nothing, so that a read tells where it ran
+	db, err := NewDB("sqlite3", ":memory:", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&DB{DB: db.replicas.dbs[0]}).MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := db.As(Caller{Client: "10.0.0.1"})
+	if _, err := writer.Create(Article{ID: "9527", Title: NullString{String: "數讀政治獻金", Valid: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Get(Article{ID: "9527"}); err != nil {
+		t.Errorf("Expected the writer to read its write from the primary, got %v", err)
+	}
+	if _, err := db.As(Caller{Client: "10.0.0.2"}).Get(Article{ID: "9527"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected another client to read from the replica, got %v", err)
+	}
+	if _, err := db.Get(Article{ID: "9527"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected an anonymous read to go to the replica, got %v", err)
+	}
+
+	db.replicas.markDown(db.replicas.dbs[0])
+	if _, err := db.Get(Article{ID: "9527"}); err != nil {
+		t.Errorf("Expected reads to fall back to the primary without a healthy replica, got %v", err)
+	}
+}
+
+func TestLRUEvictsTheLeastRecentlyUsed(t *testing.T) {
+
+	cache := NewLRU(2)
+	cache.Set("article:9527", Article{ID: "9527"}, time.Minute)
+	cache.Set("article:5566", Article{ID: "5566"}, time.Minute)
+	cache.Get("article:9527")
+	cache.Set("article:3345678", Article{ID: "3345678"}, time.Minute)
+
+	if _, ok := cache.Get("article:5566"); ok {
+		t.Error("Expected the least recently used record to be evicted")
+	}
+	if _, ok := cache.Get("article:9527"); !ok {
+		t.Error("Expected the record read lately to be kept")
+	}
+	cache.Set("article:9527", Article{ID: "9527"}, -time.Second)
+	if _, ok := cache.Get("article:9527"); ok || cache.Len() != 1 {
+		t.Errorf("Expected the expired record to be dropped, %d left", cache.Len())
+	}
+}
+
+// countingDB counts the gets which reach the Datastore, and holds them until release is closed
+type countingDB struct {
+	Datastore
+	gets    *int32
+	release chan struct{}
+}
+
+func (c countingDB) Get(item TableStruct) (TableStruct, error) {
+	atomic.AddInt32(c.gets, 1)
+	<-c.release
+	return c.Datastore.Get(item)
+}
+
+func TestCachedDatastoreReadsThroughAndEvictsWrites(t *testing.T) {
+
+	db, err := NewMemoryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	gets, release := int32(0), make(chan struct{})
+	close(release)
+	ds := NewCachedDatastore(countingDB{Datastore: db, gets: &gets, release: release}, NewLRU(10), CacheTTLs{"article": time.Minute})
+
+	if _, err := ds.Create(Article{ID: "9527", Title: NullString{String: "數讀政治獻金", Valid: true}}); err != nil {
+		t.Fatal(err)
+	}
+	ds.Get(Article{ID: "9527"})
+	ds.Get(Article{ID: "9527"})
+	if gets != 1 {
+		t.Errorf("Expected the second get to be served from the cache, got %d gets", gets)
+	}
+
+	if _, err := ds.Update(Article{ID: "9527", Title: NullString{String: "台北不是我的家", Valid: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := ds.Get(Article{ID: "9527"}); item.(Article).Title.String != "台北不是我的家" {
+		t.Errorf("Expected the update to evict the cached article, got %v", item)
+	}
+
+	err = ds.WithTx(func(tx Datastore) error {
+		_, err := tx.Update(Article{ID: "9527", Title: NullString{String: "數讀政治獻金", Valid: true}})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := ds.Get(Article{ID: "9527"}); item.(Article).Title.String != "數讀政治獻金" {
+		t.Errorf("Expected the update of the transaction to evict the cached article, got %v", item)
+	}
+}
+
+func TestCachedDatastoreCoalescesConcurrentGets(t *testing.T) {
+
+	db, err := NewMemoryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Create(Article{ID: "9527", Title: NullString{String: "數讀政治獻金", Valid: true}}); err != nil {
+		t.Fatal(err)
+	}
+	gets, release := int32(0), make(chan struct{})
+	ds := NewCachedDatastore(countingDB{Datastore: db, gets: &gets, release: release}, NewLRU(10), CacheTTLs{"article": time.Minute})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ds.Get(Article{ID: "9527"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// Let every get reach the cache before the first read of the database completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if gets != 1 {
+		t.Errorf("Expected the concurrent gets to share a single read, got %d", gets)
+	}
+}
+
+func TestDeleteOfAMissingRecordIsNotFound(t *testing.T) {
+
+	db, err := NewMemoryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Audited deletes read the record beforehand, which must not be what tells it is missing
+	db.Audit = false
+	if _, err := db.Delete(Article{ID: "5566"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the delete to find no article, got %v", err)
+	}
+}
+
+func TestCreatesAreRevised(t *testing.T) {
+
+	db, err := NewMemoryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	draft := func(id string) Article {
+		return Article{ID: id, Author: NullString{String: "洪晟熊", Valid: true}, Title: NullString{String: "Draft", Valid: true}}
+	}
+	if _, err := db.Create(draft("5566")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateMany([]TableStruct{draft("5567"), draft("5568")}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"5566", "5567", "5568"} {
+		revisions, total, err := db.ListRevisions(Article{ID: id}, 10, 0)
+		if err != nil || total != 1 || revisions[0].Number != 1 {
+			t.Fatalf("Expected article %s to be revised once, got %v %v", id, revisions, err)
+		}
+		rev, err := db.GetRevision(Article{ID: id}, 1)
+		if err != nil || rev.Record.(Article).Title.String != "Draft" {
+			t.Errorf("Expected article %s as created, got %+v %v", id, rev, err)
+		}
+	}
+}
+
+func TestCachedDatastoreLetsWritersReadTheirWrites(t *testing.T) {
+
+	// The replica is a database of its own, which never catches up with the primary
+	db, err := NewDB("sqlite3", ":memory:", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	replica := db.replicas.dbs[0]
+	if _, err := (&DB{DB: replica}).MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	article := Article{ID: "9527", Title: NullString{String: "數讀政治獻金", Valid: true}}
+	if err := insertIntoTable(replica, article); err != nil {
+		t.Fatal(err)
+	}
+	ds := NewCachedDatastore(db, NewLRU(10), CacheTTLs{"article": time.Minute})
+	writer, reader := ds.As(Caller{Client: "10.0.0.1"}), ds.As(Caller{Client: "10.0.0.2"})
+
+	if _, err := writer.Create(article); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Update(Article{ID: "9527", Title: NullString{String: "台北不是我的家", Valid: true}}); err != nil {
+		t.Fatal(err)
+	}
+	// The stale record read from the replica after the update is cached again
+	if got, err := reader.Get(Article{ID: "9527"}); err != nil || got.(Article).Title.String != "數讀政治獻金" {
+		t.Fatalf("Expected the reader to see the replica, got %+v %v", got, err)
+	}
+	if got, err := writer.Get(Article{ID: "9527"}); err != nil || got.(Article).Title.String != "台北不是我的家" {
+		t.Errorf("Expected the writer to read its write past the cache, got %+v %v", got, err)
+	}
+	if got, err := reader.Get(Article{ID: "9527"}); err != nil || got.(Article).Title.String != "台北不是我的家" {
+		t.Errorf("Expected what the writer read to be cached in place of the stale record, got %+v %v", got, err)
+	}
+}
+
+func TestAuditTimeRangeWestOfUTC(t *testing.T) {
+
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.FixedZone("PST", -8*60*60)
+
+	db, err := NewMemoryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Create(Article{ID: "5566", Author: NullString{String: "洪晟熊", Valid: true}}); err != nil {
+		t.Fatal(err)
+	}
+	since, until := time.Now().Add(-time.Minute), time.Now().Add(time.Minute)
+	if _, total, err := db.ListAudit(AuditQuery{RecordID: "5566", Since: since, Until: until, Limit: 10}); err != nil || total != 1 {
+		t.Errorf("Expected the creation to be within the last minute, got %d %v", total, err)
+	}
+}
+
+func TestPurgesAreAudited(t *testing.T) {
+
+	db, err := NewMemoryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Create(Article{ID: "5566", Author: NullString{String: "洪晟熊", Valid: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Delete(Article{ID: "5566"}); err != nil {
+		t.Fatal(err)
+	}
+	if purged, err := db.As(Caller{Actor: "admin"}).Purge(Article{}, time.Now().Add(time.Hour)); err != nil || purged != 1 {
+		t.Fatalf("Expected the article to be purged, got %d %v", purged, err)
+	}
+	entries, _, err := db.ListAudit(AuditQuery{RecordID: "5566", Limit: 1})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected the purge to be logged, got %v %v", entries, err)
+	}
+	if entry := entries[0]; entry.Operation != AuditPurge || entry.Actor.String != "admin" || !entry.Before.Valid || entry.After.Valid {
+		t.Errorf("Expected the purge of the article by the admin, got %+v", entry)
+	}
+}
+
+func TestValidateSchemaChecksRevisionsAndAuditLog(t *testing.T) {
+
+	db, err := NewMemoryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	all, err := Migrations("sqlite3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Back to the members and articles alone
+	if _, err := db.MigrateDown(len(all) - 2); err != nil {
+		t.Fatal(err)
+	}
+	mismatches, err := db.ValidateSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := map[string]bool{}
+	for _, m := range mismatches {
+		missing[m.Table] = m.Breaking()
+	}
+	if len(missing) != 2 || !missing["article_revisions"] || !missing["audit_log"] {
+		t.Errorf("Expected the revisions and the audit log to be reported missing, got %v", mismatches)
+	}
+
+	db.Audit = false
+	if mismatches, err := db.ValidateSchema(); err != nil || len(mismatches) != 1 {
+		t.Errorf("Expected the audit log to be left alone without auditing, got %v %v", mismatches, err)
+	}
+}
+
+func TestTransientErrors(t *testing.T) {
+
+	transient := []error{
+		driver.ErrBadConn,
+		fmt.Errorf("query: %w", driver.ErrBadConn),
+		&mysql.MySQLError{Number: mysqlDeadlock},
+		&pq.Error{Code: pqSerializationFailure},
+		sqlite3.Error{Code: sqlite3.ErrBusy},
+		&net.OpError{Op: "dial", Err: errors.New("connection refused")},
+	}
+	for _, err := range transient {
+		if !isTransient(err) {
+			t.Errorf("Expected %v to be transient", err)
+		}
+	}
+	permanent := []error{
+		nil,
+		errors.New("syntax error"),
+		&mysql.MySQLError{Number: 1062},
+		&pq.Error{Code: "23505"},
+		sqlite3.Error{Code: sqlite3.ErrConstraint},
+		NewError(ErrNotFound, "Article Not Found", nil),
+	}
+	for _, err := range permanent {
+		if isTransient(err) {
+			t.Errorf("Expected %v not to be transient", err)
+		}
+	}
+}
+
+func TestBackoffDoublesUpToTheMaximum(t *testing.T) {
+
+	p := RetryPolicy{Attempts: 10, BaseDelay: 10 * time.Millisecond, MaxDelay: 100 * time.Millisecond}
+	for attempt, delay := range []time.Duration{10, 20, 40, 80, 100, 100, 100} {
+		delay *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if got := p.backoff(attempt); got < delay/2 || got > delay {
+				t.Fatalf("Expected the delay after attempt %d within [%s, %s], got %s", attempt, delay/2, delay, got)
+			}
+		}
+	}
+}
+
+func TestDoRetriesAndTripsTheBreaker(t *testing.T) {
+
+	db := &DB{
+		Retry:   RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		Breaker: NewCircuitBreaker(2, 50*time.Millisecond),
+	}
+	attempts := 0
+	failing := func(errs ...error) func() error {
+		attempts = 0
+		return func() error {
+			attempts++
+			if attempts <= len(errs) {
+				return errs[attempts-1]
+			}
+			return nil
+		}
+	}
+	state := func() (int, bool) {
+		db.Breaker.mu.Lock()
+		defer db.Breaker.mu.Unlock()
+		return db.Breaker.failures, db.Breaker.failures < db.Breaker.Threshold
+	}
+
+	// A transient failure is retried until it goes away
+	if err := db.do(failing(driver.ErrBadConn)); err != nil || attempts != 2 {
+		t.Errorf("Expected success on the second attempt, got %v after %d", err, attempts)
+	}
+	// Other failures are returned right away, and don't count against the database
+	notFound := NewError(ErrNotFound, "Article Not Found", nil)
+	if err := db.do(failing(notFound)); err != notFound || attempts != 1 {
+		t.Errorf("Expected the failure after a single attempt, got %v after %d", err, attempts)
+	}
+	if failures, closed := state(); failures != 0 || !closed {
+		t.Errorf("Expected a closed circuit, got %d failures", failures)
+	}
+
+	// Running out of attempts counts as one failure, and the threshold opens the circuit
+	for i := 1; i <= 2; i++ {
+		err := db.do(failing(driver.ErrBadConn, driver.ErrBadConn, driver.ErrBadConn))
+		if !errors.Is(err, ErrUnavailable) || attempts != 3 {
+			t.Fatalf("Expected the database to be unavailable after 3 attempts, got %v after %d", err, attempts)
+		}
+		if failures, closed := state(); failures != i || closed != (i < 2) {
+			t.Fatalf("Expected %d failures, got %d with the circuit closed: %v", i, failures, closed)
+		}
+	}
+	if err := db.do(failing()); !errors.Is(err, ErrUnavailable) || attempts != 0 {
+		t.Errorf("Expected the open circuit to fail fast, got %v after %d attempts", err, attempts)
+	}
+
+	// Once the cooldown is over a query is let through, and its failure opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	if err := db.do(failing(driver.ErrBadConn, driver.ErrBadConn, driver.ErrBadConn)); !errors.Is(err, ErrUnavailable) || attempts != 3 {
+		t.Errorf("Expected a query to be let through after the cooldown, got %v after %d", err, attempts)
+	}
+	if err := db.do(failing()); !errors.Is(err, ErrUnavailable) || attempts != 0 {
+		t.Errorf("Expected the circuit to open again, got %v after %d attempts", err, attempts)
+	}
+
+	// and its success closes it
+	time.Sleep(60 * time.Millisecond)
+	if err := db.do(failing()); err != nil || attempts != 1 {
+		t.Errorf("Expected a query to be let through after the cooldown, got %v after %d", err, attempts)
+	}
+	if failures, closed := state(); failures != 0 || !closed {
+		t.Errorf("Expected the success to close the circuit, got %d failures", failures)
+	}
+}
+
+func TestWithTxCommitsOrRollsBackEveryWrite(t *testing.T) {
+
+	db, err := NewMemoryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	writes := func(ds Datastore, id string) error {
+		if _, err := ds.Create(Article{ID: id, Author: NullString{String: "洪晟熊", Valid: true}}); err != nil {
+			return err
+		}
+		_, err := ds.Create(Member{ID: id})
+		return err
+	}
+
+	failure := errors.New("changed my mind")
+	err = db.WithTx(func(ds Datastore) error {
+		if err := writes(ds, "5566"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("Expected the failure of fn, got %v", err)
+	}
+	if _, err := db.Get(Article{ID: "5566"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the article to be rolled back, got %v", err)
+	}
+	if _, err := db.Get(Member{ID: "5566"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the member to be rolled back, got %v", err)
+	}
+	if _, total, err := db.ListAudit(AuditQuery{RecordID: "5566"}); err != nil || total != 0 {
+		t.Errorf("Expected the audit entries to be rolled back, got %d %v", total, err)
+	}
+
+	if err := db.WithTx(func(ds Datastore) error { return writes(ds, "5567") }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(Article{ID: "5567"}); err != nil {
+		t.Errorf("Expected the article to be committed, got %v", err)
+	}
+	if _, err := db.Get(Member{ID: "5567"}); err != nil {
+		t.Errorf("Expected the member to be committed, got %v", err)
+	}
+}
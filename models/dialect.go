@@ -0,0 +1,71 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Error codes of duplicate keys
+const (
+	mysqlDuplicateEntry = 1062
+	pqUniqueViolation   = "23505"
+)
+
+// dialect holds what differs between the databases DB runs on.
+// It is looked up by the name of the driver of a Runner, so that both *DB and *sqlx.Tx tell theirs.
+// Placeholders differ as well: queries are written with ? and rebound by the Runner, see sqlx.Rebind.
+type dialect struct {
+	// maxPlaceholders is the number of parameters accepted in a single statement
+	maxPlaceholders int
+	// isDuplicate reports whether err is the violation of a primary key or unique index
+	isDuplicate func(err error) bool
+	// columnsQuery lists the columns of the table bound to its only parameter
+	columnsQuery string
+	// nullsLast is set if NULLs sort after every value in ascending order
+	nullsLast bool
+	// lockRows is appended to a SELECT to lock the rows it reads until the transaction ends.
+	// SQLite locks the whole database on writes, and only runs a single connection, see NewDB.
+	lockRows string
+}
+
+var dialects = map[string]dialect{
+	"mysql": {
+		maxPlaceholders: 65535,
+		isDuplicate: func(err error) bool {
+			var mysqlErr *mysql.MySQLError
+			return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+		},
+		columnsQuery: "SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?",
+		lockRows:     " FOR UPDATE",
+	},
+	"postgres": {
+		maxPlaceholders: 65535,
+		isDuplicate: func(err error) bool {
+			var pqErr *pq.Error
+			return errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation
+		},
+		columnsQuery: "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ?",
+		nullsLast:    true,
+		lockRows:     " FOR UPDATE",
+	},
+	"sqlite3": {
+		maxPlaceholders: 32766,
+		isDuplicate: func(err error) bool {
+			var sqliteErr sqlite3.Error
+			return errors.As(err, &sqliteErr) &&
+				(sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey || sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique)
+		},
+		columnsQuery: "SELECT name FROM pragma_table_info(?)",
+	},
+}
+
+// dialectOf returns the dialect of the database db runs its queries on
+func dialectOf(db Runner) dialect {
+	if d, ok := dialects[db.DriverName()]; ok {
+		return d
+	}
+	return dialects["mysql"]
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+)
+
+// Kinds of errors returned by the models package. Test them with errors.Is.
+var (
+	ErrNotFound             = errors.New("not found")
+	ErrConflict             = errors.New("conflict")
+	ErrValidation           = errors.New("validation failed")
+	ErrConcurrency          = errors.New("concurrent modification")
+	ErrInternal             = errors.New("internal error")
+	ErrUnavailable          = errors.New("service unavailable")
+	ErrAborted              = errors.New("aborted")
+	ErrPreconditionRequired = errors.New("precondition required")
+)
+
+// Error is the error type returned by the models package.
+// Kind is one of the sentinel errors above, Message is safe to show to clients,
+// and Err keeps the underlying driver error, if any, for logging.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+// NewError creates an Error of kind with a client facing message, wrapping err
+func NewError(kind error, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap exposes the driver error to errors.Is and errors.As
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether e is of the kind target
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// internalError wraps an unexpected driver error without leaking it to clients
+func internalError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return NewError(ErrInternal, "Internal Server Error", err)
+}
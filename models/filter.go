@@ -0,0 +1,256 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter is a single condition parsed from the query string of a list request.
+// Column is always taken from a db struct tag, so it is safe to put into SQL as is.
+type Filter struct {
+	Column   string
+	Operator string
+	Values   []interface{}
+}
+
+// Sort orders a list by Column, in descending order if Desc is set
+type Sort struct {
+	Column string
+	Desc   bool
+}
+
+type columnKind int
+
+const (
+	textColumn columnKind = iota
+	numberColumn
+	boolColumn
+	timeColumn
+)
+
+type column struct {
+	name string
+	kind columnKind
+}
+
+// Range operators usable as a suffix on the field name, e.g. like_amount_gte=100.
+// _after and _before only apply to time columns.
+var filterSuffixes = []struct {
+	suffix   string
+	operator string
+	timeOnly bool
+}{
+	{"_after", ">", true},
+	{"_before", "<", true},
+	{"_gte", ">=", false},
+	{"_lte", "<=", false},
+	{"_gt", ">", false},
+	{"_lt", "<", false},
+}
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// columnsOf builds the whitelist of filterable and sortable columns from the db tags of item.
+// Each column can be referred to by its db tag or its json tag.
+// Time columns with a json tag ending in _at are also reachable without the suffix,
+// so that create_time could be filtered with created_after.
+func columnsOf(item interface{}) map[string]column {
+
+	columns := make(map[string]column)
+	t := reflect.TypeOf(item)
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag
+		dbName, jsonName := tag.Get("db"), strings.Split(tag.Get("json"), ",")[0]
+		if dbName == "" || jsonName == "-" {
+			continue
+		}
+
+		col := column{name: dbName}
+		switch reflect.Zero(t.Field(i).Type).Interface().(type) {
+		case string, NullString:
+			col.kind = textColumn
+		case int, NullInt:
+			col.kind = numberColumn
+		case bool, NullBool:
+			col.kind = boolColumn
+		case NullTime:
+			col.kind = timeColumn
+		default:
+			continue
+		}
+
+		columns[dbName] = col
+		if jsonName != "" {
+			columns[jsonName] = col
+			if col.kind == timeColumn && strings.HasSuffix(jsonName, "_at") {
+				columns[strings.TrimSuffix(jsonName, "_at")] = col
+			}
+		}
+	}
+	return columns
+}
+
+func (col column) parse(value string) (interface{}, error) {
+	switch col.kind {
+	case numberColumn:
+		return strconv.Atoi(value)
+	case boolColumn:
+		return strconv.ParseBool(value)
+	case timeColumn:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t, nil
+			}
+		}
+		return nil, errors.New("invalid time")
+	}
+	return value, nil
+}
+
+// ParseFilters translates query parameters into filters on the columns of item.
+// A bare field name matches by equality, and repeating it matches any of the values.
+// Range conditions are written with one of the suffixes in filterSuffixes.
+// Unknown fields are rejected.
+func ParseFilters(item interface{}, query url.Values) ([]Filter, error) {
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	columns := columnsOf(item)
+	filters := make([]Filter, 0, len(query))
+	for _, key := range keys {
+
+		values := query[key]
+		filter := Filter{Operator: "="}
+		col, ok := columns[key]
+		if !ok {
+			for _, s := range filterSuffixes {
+				if base := strings.TrimSuffix(key, s.suffix); base != key {
+					if c, found := columns[base]; found && c.kind != boolColumn && c.kind != textColumn && (!s.timeOnly || c.kind == timeColumn) {
+						col, ok, filter.Operator = c, true, s.operator
+						break
+					}
+				}
+			}
+		}
+		if !ok {
+			return nil, NewError(ErrValidation, "Invalid Filter: "+key, nil)
+		}
+		if filter.Operator != "=" && len(values) > 1 {
+			return nil, NewError(ErrValidation, "Invalid Filter: "+key, nil)
+		}
+
+		filter.Column = col.name
+		for _, value := range values {
+			v, err := col.parse(value)
+			if err != nil {
+				return nil, NewError(ErrValidation, "Invalid Filter Value: "+key, err)
+			}
+			filter.Values = append(filter.Values, v)
+		}
+		if len(values) > 1 {
+			filter.Operator = "IN"
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// ParseSort translates a comma separated list of fields into sorts on the columns of item.
+// A leading "-" sorts the field in descending order, e.g. sort=-like_amount,create_time
+func ParseSort(item interface{}, fields string) ([]Sort, error) {
+
+	columns := columnsOf(item)
+	sorts := make([]Sort, 0)
+	for _, field := range strings.Split(fields, ",") {
+		s := Sort{}
+		if strings.HasPrefix(field, "-") {
+			s.Desc = true
+			field = field[1:]
+		}
+		col, ok := columns[field]
+		if !ok {
+			return nil, NewError(ErrValidation, "Invalid Sort: "+field, nil)
+		}
+		s.Column = col.name
+		sorts = append(sorts, s)
+	}
+	return sorts, nil
+}
+
+// whereClause renders the filters of args, along with condition if any, into a WHERE clause with ? placeholders
+func (args ListArgs) whereClause(condition string) (string, []interface{}) {
+
+	conditions := make([]string, 0, len(args.Filters)+1)
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if len(args.Filters) == 0 && len(conditions) == 0 {
+		return "", nil
+	}
+	values := make([]interface{}, 0, len(args.Filters))
+	for _, f := range args.Filters {
+		if f.Operator == "IN" {
+			conditions = append(conditions, fmt.Sprintf("%s IN (?%s)", f.Column, strings.Repeat(", ?", len(f.Values)-1)))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("%s %s ?", f.Column, f.Operator))
+		}
+		values = append(values, f.Values...)
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), values
+}
+
+// sortKeys resolves the sorts of args into the full list of keys a list is ordered by.
+// Lists without sorts are ordered by create_time, newest first.
+// The primary key is always appended so that rows with equal sort keys keep a stable order.
+func (args ListArgs) sortKeys(primaryKey string) []Sort {
+
+	sorts := args.Sorts
+	if len(sorts) == 0 {
+		sorts = []Sort{{Column: "create_time", Desc: true}}
+	}
+	keys := make([]Sort, 0, len(sorts)+1)
+	for _, s := range sorts {
+		keys = append(keys, s)
+		if s.Column == primaryKey {
+			return keys
+		}
+	}
+	return append(keys, Sort{Column: primaryKey, Desc: sorts[len(sorts)-1].Desc})
+}
+
+// orderClause renders sort keys into an ORDER BY clause, in the opposite direction if reversed is set.
+// Cursors expect NULLs to come first in ascending order, as they do on MySQL and SQLite,
+// so dialects sorting them last are told explicitly.
+func orderClause(keys []Sort, reversed bool, d dialect) string {
+
+	order := make([]string, 0, len(keys))
+	for _, s := range keys {
+		s.Desc = s.Desc != reversed
+		switch {
+		case !d.nullsLast:
+			order = append(order, s.String())
+		case s.Desc:
+			order = append(order, s.String()+" NULLS LAST")
+		default:
+			order = append(order, s.String()+" NULLS FIRST")
+		}
+	}
+	return " ORDER BY " + strings.Join(order, ", ")
+}
+
+func (s Sort) String() string {
+	if s.Desc {
+		return s.Column + " DESC"
+	}
+	return s.Column + " ASC"
+}
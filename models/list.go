@@ -0,0 +1,98 @@
+package models
+
+import (
+	"reflect"
+)
+
+const (
+	// DefaultListLimit is applied when a list request doesn't specify a limit
+	DefaultListLimit = 20
+	// MaxListLimit caps the page size of a single list request
+	MaxListLimit = 100
+)
+
+// ListArgs holds the paging, filtering and sorting options of a list request.
+// A list is paged either by Offset or by Cursor, which takes precedence.
+// Records in the trash are left out unless Visibility says otherwise.
+type ListArgs struct {
+	Limit      int
+	Offset     int
+	Cursor     *Cursor
+	Filters    []Filter
+	Sorts      []Sort
+	Visibility Visibility
+}
+
+// ListResult is one page of records along with the total count of matched rows.
+// Next and Prev are the cursors of the adjacent pages, left empty if there is no such page.
+type ListResult struct {
+	Items []TableStruct
+	Total int
+	Next  string
+	Prev  string
+}
+
+// listFromTable runs a list request against the table of the resource item belongs to
+func listFromTable(db Runner, item TableStruct, args ListArgs) (ListResult, error) {
+
+	result := ListResult{Items: []TableStruct{}}
+	r, err := ResourceOf(item)
+	if err != nil {
+		return result, err
+	}
+	table, primaryKey := r.Table, r.PrimaryKey
+	rows := reflect.New(reflect.SliceOf(r.typ))
+
+	where, values := args.whereClause(r.visibilityCondition(args.Visibility))
+	if err := db.QueryRow(db.Rebind("SELECT COUNT(*) FROM "+table+where), values...).Scan(&result.Total); err != nil {
+		return result, internalError(err)
+	}
+
+	keys := args.sortKeys(primaryKey)
+	cursor := args.Cursor
+	query := "SELECT " + r.selectColumns() + " FROM " + table + where
+	if cursor != nil {
+		if !reflect.DeepEqual(cursor.Sorts, keys) {
+			return result, errInvalidCursor
+		}
+		keyset, keysetValues := cursor.keysetClause()
+		if where == "" {
+			query += " WHERE " + keyset
+		} else {
+			query += " AND " + keyset
+		}
+		values = append(values, keysetValues...)
+		args.Offset = 0
+	}
+	backward := cursor != nil && cursor.Before
+
+	// Fetch one extra row to tell whether there is a following page
+	query += orderClause(keys, backward, dialectOf(db)) + " LIMIT ? OFFSET ?"
+	if err := db.Select(rows.Interface(), db.Rebind(query), append(values, args.Limit+1, args.Offset)...); err != nil {
+		return result, internalError(err)
+	}
+
+	page := rows.Elem()
+	more := page.Len() > args.Limit
+	if more {
+		page = page.Slice(0, args.Limit)
+	}
+	for i := 0; i < page.Len(); i++ {
+		index := i
+		if backward {
+			index = page.Len() - 1 - i
+		}
+		result.Items = append(result.Items, page.Index(index).Interface().(TableStruct))
+	}
+
+	if len(result.Items) > 0 {
+		first, last := result.Items[0], result.Items[len(result.Items)-1]
+		if (backward && more) || (!backward && (cursor != nil || args.Offset > 0)) {
+			result.Prev = encodeCursor(first, keys, true)
+		}
+		if (!backward && more) || backward {
+			result.Next = encodeCursor(last, keys, false)
+		}
+	}
+	return result, nil
+}
@@ -1,11 +1,7 @@
 package models
 
 import (
-	"database/sql"
-	"errors"
-	"fmt"
-	"log"
-	"strings"
+	"time"
 )
 
 type Member struct {
@@ -30,81 +26,54 @@ type Member struct {
 	ProfileImage NullString `json:"profile_image" db:"profile_picture"`
 	Identity     NullString `json:"identity" db:"identity"`
 
-	CustomEditor bool `json:"custom_editor" db:"c_editor"`
-	HideProfile  bool `json:"hide_profile" db:"hide_profile"`
-	ProfilePush  bool `json:"profile_push" db:"profile_push"`
-	PostPush     bool `json:"post_push" db:"post_push"`
-	CommentPush  bool `json:"comment_push" db:"comment_push"`
-	Active       bool `json:"active" db:"active"`
+	CustomEditor NullBool `json:"custom_editor" db:"c_editor"`
+	HideProfile  NullBool `json:"hide_profile" db:"hide_profile"`
+	ProfilePush  NullBool `json:"profile_push" db:"profile_push"`
+	PostPush     NullBool `json:"post_push" db:"post_push"`
+	CommentPush  NullBool `json:"comment_push" db:"comment_push"`
+	Active       NullBool `json:"active" db:"active"`
 }
 
-func (m Member) GetFromDatabase(db *DB) (TableStruct, error) {
-
-	member := Member{}
-	err := db.QueryRowx("SELECT * FROM members where user_id = ?", m.ID).StructScan(&member)
-	switch {
-	case err == sql.ErrNoRows:
-		err = errors.New("User Not Found")
-		member = Member{}
-	case err != nil:
-		log.Fatal(err)
-		member = Member{}
-	default:
-		fmt.Printf("Successful get user: %s\n", m.ID)
-		err = nil
-	}
-	return member, err
+func init() {
+	Register(Resource{
+		Name:       "member",
+		Plural:     "members",
+		Table:      "members",
+		PrimaryKey: "user_id",
+		Model:      Member{},
+		Required:   []string{"name"},
+		NotFound:   "User Not Found",
+		Conflict:   "User Already Existed",
+		Invalid:    "Invalid Member Data",
+	})
 }
 
-func (m Member) InsertIntoDatabase(db *DB) error {
-
-	query, _ := generateSQLStmt(m, "insert", "members")
-
-	result, err := db.NamedExec(query, m)
+func (m Member) GetFromDatabase(db Runner) (TableStruct, error) {
+	return getFromTable(db, m)
+}
 
-	if err != nil {
-		if strings.Contains(err.Error(), "Duplicate entry") {
-			return errors.New("Duplicate entry")
-		}
-		return err
-	}
-	rowCnt, err := result.RowsAffected()
-	if err != nil {
-		log.Fatal(err)
-	}
-	if rowCnt > 1 {
-		return errors.New("More Than One Rows Affected")
-	} else if rowCnt == 0 {
-		return errors.New("No Row Inserted")
-	}
-	return nil
+func (m Member) InsertIntoDatabase(db Runner) error {
+	return insertIntoTable(db, m)
 }
 
-func (m Member) UpdateDatabase(db *DB) error {
+func (m Member) UpdateDatabase(db Runner) error {
+	return updateTable(db, m)
+}
 
-	query, _ := generateSQLStmt(m, "partial_update", "members")
-	result, err := db.NamedExec(query, m)
+func (m Member) ReplaceInDatabase(db Runner) error {
+	return replaceInTable(db, m)
+}
 
-	if err != nil {
-		log.Fatal(err)
-		return err
-	}
-	rowCnt, err := result.RowsAffected()
-	if rowCnt > 1 {
-		return errors.New("More Than One Rows Affected")
-	} else if rowCnt == 0 {
-		return errors.New("User Not Found")
-	}
-	return nil
+func (m Member) DeleteFromDatabase(db Runner) error {
+	return deleteFromTable(db, m)
 }
 
-func (m Member) DeleteFromDatabase(db *DB) error {
+func (m Member) PurgeFromDatabase(db Runner, before time.Time) (int64, error) {
+	return purgeFromTable(db, m, before)
+}
 
-	_, err := db.Exec("UPDATE members SET active = 0 WHERE user_id = ?", m.ID)
-	if err != nil {
-		log.Fatal(err)
-	} else {
-		err = nil
-	}
-	return err
+// ListFromDatabase returns the members matching the filters of args.
+// Unless told otherwise, members are ordered by create_time, newest first.
+func (m Member) ListFromDatabase(db Runner, args ListArgs) (ListResult, error) {
+	return listFromTable(db, m, args)
 }
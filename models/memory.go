@@ -0,0 +1,20 @@
+package models
+
+// NewMemoryDB returns a Datastore holding its records in memory, for tests and demos.
+// Rather than mimicking the SQL databases, it runs their very queries on an in-memory SQLite database
+// migrated up to the current schema, so that partial updates, soft deletes, duplicate keys,
+// versions, revisions and the audit log behave just as they do on MySQL.
+// Every call returns an empty database of its own, which lives until it is closed.
+// It is safe for concurrent use: the database is kept to one connection, which serializes the queries.
+func NewMemoryDB() (*DB, error) {
+
+	db, err := NewDB("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.MigrateUp(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The schema is built by the versioned SQL files under migrations/<driver>,
+// named <version>_<name>.up.sql and <version>_<name>.down.sql.
+// Every driver has the same migrations, written in its own dialect.
+// Applied versions are tracked in the schema_migrations table.
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is a versioned change of the schema along with the statements reverting it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration has been applied, and when
+type MigrationStatus struct {
+	Migration
+	AppliedAt NullTime
+}
+
+// Migrations returns the embedded migrations of a driver in the order of their versions.
+// Every migration must come with both an up and a down file.
+func Migrations(driver string) ([]Migration, error) {
+
+	dir := path.Join("migrations", driver)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction, name = "up", strings.TrimSuffix(name, ".up.sql")
+		case strings.HasSuffix(name, ".down.sql"):
+			direction, name = "down", strings.TrimSuffix(name, ".down.sql")
+		default:
+			return nil, fmt.Errorf("migration %s is neither .up.sql nor .down.sql", entry.Name())
+		}
+		parts := strings.SplitN(name, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) < 2 {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>", entry.Name())
+		}
+		content, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+		if m.Name != parts[1] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, parts[1])
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s lacks its up or down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// statements splits a migration file into its statements, which end with a semicolon at the end of a line.
+// Comment lines are dropped.
+func statements(sql string) []string {
+
+	stmts, current := make([]string, 0), make([]string, 0)
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current = append(current, line)
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(strings.Join(current, "\n")), ";"))
+			current = current[:0]
+		}
+	}
+	if len(current) > 0 {
+		stmts = append(stmts, strings.TrimSpace(strings.Join(current, "\n")))
+	}
+	return stmts
+}
+
+// ensureSchemaTable creates the table tracking applied migrations
+func (db *DB) ensureSchemaTable() error {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at TIMESTAMP NOT NULL)")
+	return err
+}
+
+// MigrationStatus lists every embedded migration along with when it was applied
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+
+	migrations, err := Migrations(db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.ensureSchemaTable(); err != nil {
+		return nil, err
+	}
+	applied := []struct {
+		Version   int       `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}{}
+	if err := db.Select(&applied, "SELECT version, applied_at FROM schema_migrations"); err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int]time.Time)
+	for _, a := range applied {
+		appliedAt[a.Version] = a.AppliedAt
+	}
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s := MigrationStatus{Migration: m}
+		if t, ok := appliedAt[m.Version]; ok {
+			s.AppliedAt = NullTime{Time: t, Valid: true}
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// MigrateUp applies every pending migration in order, and returns those it applied
+func (db *DB) MigrateUp() ([]Migration, error) {
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]Migration, 0)
+	for _, s := range status {
+		if s.AppliedAt.Valid {
+			continue
+		}
+		if err := db.migrate(s.Migration, s.Up, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", s.Version, s.Name, time.Now()); err != nil {
+			return applied, err
+		}
+		applied = append(applied, s.Migration)
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the latest steps applied migrations, newest first, and returns those it reverted
+func (db *DB) MigrateDown(steps int) ([]Migration, error) {
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	reverted := make([]Migration, 0)
+	for i := len(status) - 1; i >= 0 && len(reverted) < steps; i-- {
+		s := status[i]
+		if !s.AppliedAt.Valid {
+			continue
+		}
+		if err := db.migrate(s.Migration, s.Down, "DELETE FROM schema_migrations WHERE version = ?", s.Version); err != nil {
+			return reverted, err
+		}
+		reverted = append(reverted, s.Migration)
+	}
+	return reverted, nil
+}
+
+// migrate runs the statements of sql, then records the change with track.
+// MySQL commits DDL statements implicitly, so a failed migration may be left half applied.
+func (db *DB) migrate(m Migration, sql string, track string, args ...interface{}) error {
+	for _, stmt := range statements(sql) {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("migration %d_%s: %v", m.Version, m.Name, err)
+		}
+	}
+	if _, err := db.Exec(db.Rebind(track), args...); err != nil {
+		return fmt.Errorf("migration %d_%s: %v", m.Version, m.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+-- Existing databases already hold the table, so it is only created when missing
+CREATE TABLE IF NOT EXISTS members (
+    user_id VARCHAR(64) NOT NULL,
+    name VARCHAR(255),
+    nick VARCHAR(255),
+    birthday DATETIME,
+    gender VARCHAR(16),
+    work VARCHAR(255),
+    mail VARCHAR(255),
+    register_mode VARCHAR(32),
+    social_id VARCHAR(255),
+    create_time DATETIME,
+    updated_at DATETIME,
+    updated_by VARCHAR(64),
+    password VARCHAR(255),
+    description TEXT,
+    profile_picture VARCHAR(1024),
+    identity VARCHAR(32),
+    c_editor TINYINT(1),
+    hide_profile TINYINT(1),
+    profile_push TINYINT(1),
+    post_push TINYINT(1),
+    comment_push TINYINT(1),
+    active TINYINT(1),
+    PRIMARY KEY (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,18 @@
+-- Existing databases already hold the table, so it is only created when missing
+CREATE TABLE IF NOT EXISTS article_infos (
+    post_id VARCHAR(64) NOT NULL,
+    author VARCHAR(255),
+    create_time DATETIME,
+    like_amount INT,
+    comment_amount INT,
+    title VARCHAR(255),
+    content TEXT,
+    link VARCHAR(1024),
+    og_title VARCHAR(255),
+    og_description TEXT,
+    og_image VARCHAR(1024),
+    active INT,
+    updated_at DATETIME,
+    updated_by VARCHAR(64),
+    PRIMARY KEY (post_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,9 @@
+CREATE TABLE article_revisions (
+    revision_id BIGINT NOT NULL AUTO_INCREMENT,
+    post_id VARCHAR(64) NOT NULL,
+    snapshot JSON NOT NULL,
+    updated_by VARCHAR(64),
+    updated_at DATETIME,
+    PRIMARY KEY (revision_id),
+    KEY article_revisions_post_id (post_id, revision_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,15 @@
+CREATE TABLE audit_log (
+    audit_id BIGINT NOT NULL AUTO_INCREMENT,
+    actor VARCHAR(64),
+    resource VARCHAR(64) NOT NULL,
+    record_id VARCHAR(64) NOT NULL,
+    operation VARCHAR(16) NOT NULL,
+    before_state JSON,
+    after_state JSON,
+    request_id VARCHAR(64),
+    created_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (audit_id),
+    KEY audit_log_actor (actor, created_at),
+    KEY audit_log_record (resource, record_id, created_at),
+    KEY audit_log_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
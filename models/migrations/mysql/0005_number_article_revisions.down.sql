@@ -0,0 +1,3 @@
+ALTER TABLE article_revisions
+    DROP INDEX article_revisions_revision,
+    DROP COLUMN revision;
@@ -0,0 +1,9 @@
+-- Revisions are numbered from 1 for every article
+ALTER TABLE article_revisions ADD COLUMN revision BIGINT;
+UPDATE article_revisions r
+JOIN (SELECT revision_id, ROW_NUMBER() OVER (PARTITION BY post_id ORDER BY revision_id) AS revision FROM article_revisions) n
+ON n.revision_id = r.revision_id
+SET r.revision = n.revision;
+ALTER TABLE article_revisions
+    MODIFY revision BIGINT NOT NULL,
+    ADD UNIQUE KEY article_revisions_revision (post_id, revision);
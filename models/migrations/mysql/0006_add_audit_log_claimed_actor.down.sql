@@ -0,0 +1,3 @@
+ALTER TABLE audit_log
+    DROP INDEX audit_log_claimed_actor,
+    DROP COLUMN claimed_actor;
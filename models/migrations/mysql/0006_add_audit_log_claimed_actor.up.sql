@@ -0,0 +1,3 @@
+-- Who the client says made the write, which nothing vouches for, kept apart from the authenticated actor
+ALTER TABLE audit_log ADD COLUMN claimed_actor VARCHAR(64);
+CREATE INDEX audit_log_claimed_actor ON audit_log (claimed_actor, created_at);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS article_infos (
+    post_id VARCHAR(64) NOT NULL PRIMARY KEY,
+    author VARCHAR(255),
+    create_time TIMESTAMPTZ,
+    like_amount INTEGER,
+    comment_amount INTEGER,
+    title VARCHAR(255),
+    content TEXT,
+    link VARCHAR(1024),
+    og_title VARCHAR(255),
+    og_description TEXT,
+    og_image VARCHAR(1024),
+    active INTEGER,
+    updated_at TIMESTAMPTZ,
+    updated_by VARCHAR(64)
+);
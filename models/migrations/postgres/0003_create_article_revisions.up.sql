@@ -0,0 +1,8 @@
+CREATE TABLE article_revisions (
+    revision_id BIGSERIAL PRIMARY KEY,
+    post_id VARCHAR(64) NOT NULL,
+    snapshot JSONB NOT NULL,
+    updated_by VARCHAR(64),
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX article_revisions_post_id ON article_revisions (post_id, revision_id);
@@ -0,0 +1,14 @@
+CREATE TABLE audit_log (
+    audit_id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(64),
+    resource VARCHAR(64) NOT NULL,
+    record_id VARCHAR(64) NOT NULL,
+    operation VARCHAR(16) NOT NULL,
+    before_state JSONB,
+    after_state JSONB,
+    request_id VARCHAR(64),
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX audit_log_actor ON audit_log (actor, created_at);
+CREATE INDEX audit_log_record ON audit_log (resource, record_id, created_at);
+CREATE INDEX audit_log_created_at ON audit_log (created_at);
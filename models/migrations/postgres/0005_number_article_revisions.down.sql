@@ -0,0 +1,2 @@
+DROP INDEX article_revisions_revision;
+ALTER TABLE article_revisions DROP COLUMN revision;
@@ -0,0 +1,8 @@
+-- Revisions are numbered from 1 for every article
+ALTER TABLE article_revisions ADD COLUMN revision BIGINT;
+UPDATE article_revisions r
+SET revision = n.revision
+FROM (SELECT revision_id, ROW_NUMBER() OVER (PARTITION BY post_id ORDER BY revision_id) AS revision FROM article_revisions) n
+WHERE n.revision_id = r.revision_id;
+ALTER TABLE article_revisions ALTER COLUMN revision SET NOT NULL;
+CREATE UNIQUE INDEX article_revisions_revision ON article_revisions (post_id, revision);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS members (
+    user_id VARCHAR(64) NOT NULL PRIMARY KEY,
+    name VARCHAR(255),
+    nick VARCHAR(255),
+    birthday DATETIME,
+    gender VARCHAR(16),
+    work VARCHAR(255),
+    mail VARCHAR(255),
+    register_mode VARCHAR(32),
+    social_id VARCHAR(255),
+    create_time DATETIME,
+    updated_at DATETIME,
+    updated_by VARCHAR(64),
+    password VARCHAR(255),
+    description TEXT,
+    profile_picture VARCHAR(1024),
+    identity VARCHAR(32),
+    c_editor BOOLEAN,
+    hide_profile BOOLEAN,
+    profile_push BOOLEAN,
+    post_push BOOLEAN,
+    comment_push BOOLEAN,
+    active BOOLEAN
+);
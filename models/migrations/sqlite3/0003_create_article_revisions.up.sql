@@ -0,0 +1,8 @@
+CREATE TABLE article_revisions (
+    revision_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id VARCHAR(64) NOT NULL,
+    snapshot TEXT NOT NULL,
+    updated_by VARCHAR(64),
+    updated_at DATETIME
+);
+CREATE INDEX article_revisions_post_id ON article_revisions (post_id, revision_id);
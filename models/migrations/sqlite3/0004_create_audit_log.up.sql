@@ -0,0 +1,14 @@
+CREATE TABLE audit_log (
+    audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor VARCHAR(64),
+    resource VARCHAR(64) NOT NULL,
+    record_id VARCHAR(64) NOT NULL,
+    operation VARCHAR(16) NOT NULL,
+    before_state TEXT,
+    after_state TEXT,
+    request_id VARCHAR(64),
+    created_at DATETIME NOT NULL
+);
+CREATE INDEX audit_log_actor ON audit_log (actor, created_at);
+CREATE INDEX audit_log_record ON audit_log (resource, record_id, created_at);
+CREATE INDEX audit_log_created_at ON audit_log (created_at);
@@ -0,0 +1,5 @@
+-- Revisions are numbered from 1 for every article
+ALTER TABLE article_revisions ADD COLUMN revision INTEGER;
+UPDATE article_revisions
+SET revision = (SELECT COUNT(*) FROM article_revisions p WHERE p.post_id = article_revisions.post_id AND p.revision_id <= article_revisions.revision_id);
+CREATE UNIQUE INDEX article_revisions_revision ON article_revisions (post_id, revision);
@@ -0,0 +1,2 @@
+DROP INDEX audit_log_claimed_actor;
+ALTER TABLE audit_log DROP COLUMN claimed_actor;
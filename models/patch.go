@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// Media types of the patch documents accepted by Patch
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// Patch applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) document to the stored record.
+// Plain application/json bodies are taken as merge patches.
+// The primary key can't be changed.
+func (r Resource) Patch(stored TableStruct, contentType string, patch []byte) (TableStruct, error) {
+
+	doc, err := json.Marshal(stored)
+	if err != nil {
+		return nil, internalError(err)
+	}
+
+	switch contentType {
+	case MergePatchType, "application/json":
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	case JSONPatchType:
+		var ops jsonpatch.Patch
+		if ops, err = jsonpatch.DecodePatch(patch); err == nil {
+			doc, err = ops.Apply(doc)
+		}
+	default:
+		return nil, NewError(ErrValidation, "Unsupported Patch Format", nil)
+	}
+	if err != nil {
+		return nil, NewError(ErrValidation, "Invalid Patch", err)
+	}
+
+	v := reflect.New(r.typ)
+	if err = json.Unmarshal(doc, v.Interface()); err != nil {
+		return nil, NewError(ErrValidation, r.Invalid, err)
+	}
+	item := v.Elem().Interface().(TableStruct)
+	if r.IDOf(item) != r.IDOf(stored) {
+		return nil, NewError(ErrValidation, "Primary Key Cannot Be Changed", nil)
+	}
+	return item, nil
+}
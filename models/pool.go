@@ -0,0 +1,115 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Pool holds the connection pool settings of a DB, applied to the primary and to every replica.
+// MaxOpenConns and MaxIdleConns are left to the database/sql defaults if 0, and lifetimes of 0 are unlimited.
+// SQLite databases are left alone: their single connection is kept for good, as in-memory ones die with it, see NewDB.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// SetPool applies the pool settings to the connections of db
+func (db *DB) SetPool(pool Pool) {
+	for _, conns := range db.pools() {
+		if conns.DriverName() == "sqlite3" {
+			continue
+		}
+		if pool.MaxOpenConns > 0 {
+			conns.SetMaxOpenConns(pool.MaxOpenConns)
+		}
+		if pool.MaxIdleConns > 0 {
+			conns.SetMaxIdleConns(pool.MaxIdleConns)
+		}
+		conns.SetConnMaxLifetime(pool.ConnMaxLifetime)
+		conns.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	}
+}
+
+// PoolStats reports the connection pool of the primary or of a replica, see sql.DBStats
+type PoolStats struct {
+	Name              string `json:"name"`
+	MaxOpen           int    `json:"max_open"`
+	Open              int    `json:"open"`
+	InUse             int    `json:"in_use"`
+	Idle              int    `json:"idle"`
+	WaitCount         int64  `json:"wait_count"`
+	WaitMillis        int64  `json:"wait_duration_ms"`
+	MaxIdleClosed     int64  `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64  `json:"max_lifetime_closed"`
+}
+
+// PoolStats reports the connection pools of db, the primary first and then the replicas, named replica-1 and so on
+func (db *DB) PoolStats() []PoolStats {
+
+	pools := db.pools()
+	stats := make([]PoolStats, len(pools))
+	for i, conns := range pools {
+		s := conns.Stats()
+		stats[i] = PoolStats{
+			MaxOpen:           s.MaxOpenConnections,
+			Open:              s.OpenConnections,
+			InUse:             s.InUse,
+			Idle:              s.Idle,
+			WaitCount:         s.WaitCount,
+			WaitMillis:        s.WaitDuration.Milliseconds(),
+			MaxIdleClosed:     s.MaxIdleClosed,
+			MaxIdleTimeClosed: s.MaxIdleTimeClosed,
+			MaxLifetimeClosed: s.MaxLifetimeClosed,
+		}
+		stats[i].Name = poolName(i)
+	}
+	return stats
+}
+
+// Health tells whether a database db depends on is up
+type Health struct {
+	Name  string `json:"name"`
+	Up    bool   `json:"up"`
+	Error string `json:"error,omitempty"`
+	// Optional is set for the replicas, which db does without by reading from the primary
+	Optional bool `json:"optional"`
+}
+
+// Health pings the primary, and reports the replicas as of their latest health check
+func (db *DB) Health(ctx context.Context) []Health {
+
+	health := []Health{{Name: poolName(0), Up: true}}
+	if err := db.PingContext(ctx); err != nil {
+		health[0] = Health{Name: poolName(0), Error: err.Error()}
+	}
+	if db.replicas != nil {
+		for i := range db.replicas.dbs {
+			health = append(health, Health{Name: poolName(i + 1), Up: atomic.LoadInt32(&db.replicas.healthy[i]) == 1, Optional: true})
+		}
+	}
+	return health
+}
+
+// poolName names the primary, at 0, and the replicas after it
+func poolName(i int) string {
+	if i == 0 {
+		return "primary"
+	}
+	return fmt.Sprintf("replica-%d", i)
+}
+
+// pools returns the connection pools of db, the primary first
+func (db *DB) pools() []*sqlx.DB {
+	pools := []*sqlx.DB{db.DB}
+	if db.replicas != nil {
+		pools = append(pools, db.replicas.dbs...)
+	}
+	return pools
+}
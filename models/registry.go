@@ -0,0 +1,206 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Resource describes a TableStruct type served by the API.
+// Name and Plural are the route names of a single record and of the list, e.g. /member/:id and /members.
+// Required lists the columns a record must hold when it is replaced as a whole.
+// The messages are shown to clients when a record of the resource is missing, taken or malformed.
+// OnCreate and OnUpdate, if set, adjust a record right before it is written.
+// If RevisionTable is set, every update of a record is snapshotted into it, see Revision.
+type Resource struct {
+	Name          string
+	Plural        string
+	Table         string
+	PrimaryKey    string
+	Model         TableStruct
+	Required      []string
+	RevisionTable string
+
+	NotFound string
+	Conflict string
+	Invalid  string
+
+	OnCreate func(TableStruct) TableStruct
+	OnUpdate func(TableStruct) TableStruct
+
+	typ reflect.Type
+}
+
+var registry = struct {
+	sync.RWMutex
+	byType    map[reflect.Type]*Resource
+	resources []*Resource
+}{byType: make(map[reflect.Type]*Resource)}
+
+// Register makes a resource available to DB and to the generic handlers.
+// It is meant to be called from init, and panics if the model is registered twice
+// or lacks a field tagged with the primary key or a required column.
+func Register(r Resource) {
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	r.typ = reflect.TypeOf(r.Model)
+	if _, dup := registry.byType[r.typ]; dup {
+		panic(fmt.Sprintf("models: Register called twice for %s", r.typ))
+	}
+	for _, column := range append([]string{r.PrimaryKey}, r.Required...) {
+		if r.field(column) < 0 {
+			panic(fmt.Sprintf("models: %s has no field tagged with %s", r.typ, column))
+		}
+	}
+	if r.NotFound == "" {
+		r.NotFound = fmt.Sprintf("%s Not Found", r.typ.Name())
+	}
+	if r.Conflict == "" {
+		r.Conflict = fmt.Sprintf("%s Already Existed", r.typ.Name())
+	}
+	if r.Invalid == "" {
+		r.Invalid = fmt.Sprintf("Invalid %s Data", r.typ.Name())
+	}
+	registry.byType[r.typ] = &r
+	registry.resources = append(registry.resources, &r)
+}
+
+// Resources returns every registered resource in the order of registration
+func Resources() []Resource {
+
+	registry.RLock()
+	defer registry.RUnlock()
+
+	resources := make([]Resource, 0, len(registry.resources))
+	for _, r := range registry.resources {
+		resources = append(resources, *r)
+	}
+	return resources
+}
+
+// ResourceOf returns the resource item belongs to
+func ResourceOf(item TableStruct) (Resource, error) {
+
+	registry.RLock()
+	defer registry.RUnlock()
+
+	r, ok := registry.byType[reflect.TypeOf(item)]
+	if !ok {
+		return Resource{}, internalError(fmt.Errorf("%T is not a registered resource", item))
+	}
+	return *r, nil
+}
+
+// field returns the index of the struct field tagged with column, or -1
+func (r Resource) field(column string) int {
+	for i := 0; i < r.typ.NumField(); i++ {
+		if r.typ.Field(i).Tag.Get("db") == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// Columns returns the columns the fields of the resource are tagged with, in the order of the fields
+func (r Resource) Columns() []string {
+	columns := make([]string, 0, r.typ.NumField())
+	for i := 0; i < r.typ.NumField(); i++ {
+		if column := r.typ.Field(i).Tag.Get("db"); column != "" && column != "-" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// selectColumns is the explicit column list queries select records of r with,
+// so that columns added to the table don't break scanning into the struct
+func (r Resource) selectColumns() string {
+	return strings.Join(r.Columns(), ", ")
+}
+
+// WithID returns an empty record of the resource identified by id
+func (r Resource) WithID(id string) TableStruct {
+	v := reflect.New(r.typ).Elem()
+	v.Field(r.field(r.PrimaryKey)).SetString(id)
+	return v.Interface().(TableStruct)
+}
+
+// IDOf returns the primary key of item
+func (r Resource) IDOf(item TableStruct) string {
+	return reflect.ValueOf(item).Field(r.field(r.PrimaryKey)).String()
+}
+
+// Decode fills a new record of the resource with bind, e.g. gin.Context.ShouldBind
+func (r Resource) Decode(bind func(interface{}) error) (TableStruct, error) {
+
+	v := reflect.New(r.typ)
+	if err := bind(v.Interface()); err != nil {
+		return nil, NewError(ErrValidation, r.Invalid, err)
+	}
+	item := v.Elem().Interface().(TableStruct)
+	if r.IDOf(item) == "" {
+		return nil, NewError(ErrValidation, r.Invalid, nil)
+	}
+	return item, nil
+}
+
+// PrepareCreate stamps create_time of a new record, unless given by the client, and its version.
+// The version is always stamped by the server, as clients echoing a record they read would keep its ETag.
+func (r Resource) PrepareCreate(item TableStruct) TableStruct {
+
+	v := reflect.New(r.typ).Elem()
+	v.Set(reflect.ValueOf(item))
+	if i := r.field("create_time"); i >= 0 {
+		if t, ok := v.Field(i).Interface().(NullTime); ok && !t.Valid {
+			v.Field(i).Set(reflect.ValueOf(NullTime{Time: stamp(), Valid: true}))
+		}
+	}
+	r.setVersion(v)
+	item = v.Interface().(TableStruct)
+	if r.OnCreate != nil {
+		item = r.OnCreate(item)
+	}
+	return item
+}
+
+// PrepareUpdate keeps create_time untouched and stamps the version, whatever the client sent
+func (r Resource) PrepareUpdate(item TableStruct) TableStruct {
+
+	v := reflect.New(r.typ).Elem()
+	v.Set(reflect.ValueOf(item))
+	if i := r.field("create_time"); i >= 0 {
+		if _, ok := v.Field(i).Interface().(NullTime); ok {
+			v.Field(i).Set(reflect.ValueOf(NullTime{}))
+		}
+	}
+	r.setVersion(v)
+	item = v.Interface().(TableStruct)
+	if r.OnUpdate != nil {
+		item = r.OnUpdate(item)
+	}
+	return item
+}
+
+// Validate checks that every required column of item is set
+func (r Resource) Validate(item TableStruct) error {
+
+	v := reflect.ValueOf(item)
+	for _, column := range r.Required {
+		missing := false
+		switch field := v.Field(r.field(column)).Interface().(type) {
+		case NullString:
+			missing = !field.Valid || field.String == ""
+		case NullTime:
+			missing = !field.Valid
+		default:
+			missing = v.Field(r.field(column)).IsZero()
+		}
+		if missing {
+			return NewError(ErrValidation, fmt.Sprintf("Missing Required Field: %s", column), nil)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Reads of single records and lists are spread over the replicas of a DB, if it has any,
+// while writes and every other query go to the primary.
+// Replicas lag behind the primary, so a client which has just written reads from the primary
+// for the StickyWindow of the DB, telling itself apart by the Client of its Caller.
+
+// DefaultStickyWindow is how long NewDB sends the reads of a client to the primary after it writes
+const DefaultStickyWindow = 5 * time.Second
+
+// replicaCheckInterval is how often the health of the replicas is checked
+const replicaCheckInterval = 5 * time.Second
+
+// replicaSet picks the replica a read runs on, round-robin among those which are healthy
+type replicaSet struct {
+	dbs     []*sqlx.DB
+	healthy []int32
+	next    uint32
+	done    chan struct{}
+
+	mu     sync.Mutex
+	sticky map[string]time.Time
+}
+
+func newReplicaSet(dbs []*sqlx.DB) *replicaSet {
+	rs := &replicaSet{dbs: dbs, healthy: make([]int32, len(dbs)), done: make(chan struct{}), sticky: make(map[string]time.Time)}
+	rs.check()
+	go rs.watch(replicaCheckInterval)
+	return rs
+}
+
+// check pings every replica, and marks it healthy if it answers
+func (rs *replicaSet) check() {
+	for i, replica := range rs.dbs {
+		healthy := int32(0)
+		if replica.Ping() == nil {
+			healthy = 1
+		}
+		atomic.StoreInt32(&rs.healthy[i], healthy)
+	}
+}
+
+func (rs *replicaSet) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rs.check()
+			rs.unstick()
+		case <-rs.done:
+			return
+		}
+	}
+}
+
+// pick returns the next healthy replica, or nil if none is
+func (rs *replicaSet) pick() *sqlx.DB {
+	for range rs.dbs {
+		i := int(atomic.AddUint32(&rs.next, 1)-1) % len(rs.dbs)
+		if atomic.LoadInt32(&rs.healthy[i]) == 1 {
+			return rs.dbs[i]
+		}
+	}
+	return nil
+}
+
+// markDown takes a replica out of the rotation until it passes the next health check
+func (rs *replicaSet) markDown(replica Runner) {
+	for i := range rs.dbs {
+		if Runner(rs.dbs[i]) == replica {
+			atomic.StoreInt32(&rs.healthy[i], 0)
+		}
+	}
+}
+
+// stick sends the reads of client to the primary until until
+func (rs *replicaSet) stick(client string, until time.Time) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.sticky[client] = until
+}
+
+// stuck reports whether the reads of client go to the primary
+func (rs *replicaSet) stuck(client string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	until, ok := rs.sticky[client]
+	return ok && time.Now().Before(until)
+}
+
+// unstick forgets the clients whose window is over
+func (rs *replicaSet) unstick() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	now := time.Now()
+	for client, until := range rs.sticky {
+		if now.After(until) {
+			delete(rs.sticky, client)
+		}
+	}
+}
+
+func (rs *replicaSet) close() error {
+	close(rs.done)
+	var err error
+	for _, replica := range rs.dbs {
+		if cerr := replica.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// sticky reports whether the caller of db wrote within the sticky window, and reads from the primary
+func (db *DB) sticky() bool {
+	return db.replicas != nil && db.caller.Client != "" && db.replicas.stuck(db.caller.Client)
+}
+
+// reader returns what a read of db runs on: a healthy replica,
+// unless the caller wrote within the sticky window or no replica is healthy
+func (db *DB) reader() Runner {
+	if db.replicas == nil || db.sticky() {
+		return db
+	}
+	if replica := db.replicas.pick(); replica != nil {
+		return replica
+	}
+	return db
+}
+
+// read runs op on the reader of db. A replica failing transiently is taken out of the rotation,
+// so that the retry goes to another one.
+func (db *DB) read(op func(Runner) error) error {
+	return db.do(func() error {
+		reader := db.reader()
+		err := op(reader)
+		if isTransient(err) && reader != Runner(db) {
+			db.replicas.markDown(reader)
+		}
+		return err
+	})
+}
+
+// wrote starts the sticky window of the caller of db
+func (db *DB) wrote() {
+	if db.replicas != nil && db.caller.Client != "" {
+		db.replicas.stick(db.caller.Client, time.Now().Add(db.StickyWindow))
+	}
+}
+
+// Close closes the primary and the replicas
+func (db *DB) Close() error {
+	if db.replicas != nil {
+		db.replicas.close()
+	}
+	return db.DB.Close()
+}
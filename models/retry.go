@@ -0,0 +1,150 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// MySQL server error numbers worth retrying
+const (
+	mysqlTooManyConnections = 1040
+	mysqlServerShutdown     = 1053
+	mysqlLockWaitTimeout    = 1205
+	mysqlDeadlock           = 1213
+)
+
+// PostgreSQL error codes worth retrying
+const (
+	pqSerializationFailure = "40001"
+	pqDeadlockDetected     = "40P01"
+	pqTooManyConnections   = "53300"
+	pqAdminShutdown        = "57P01"
+)
+
+// isTransient reports whether err is caused by a temporary database failure,
+// e.g. a deadlock or a lost connection, so that the operation could succeed if retried
+func isTransient(err error) bool {
+
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlTooManyConnections, mysqlServerShutdown, mysqlLockWaitTimeout, mysqlDeadlock:
+			return true
+		}
+		return false
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqSerializationFailure, pqDeadlockDetected, pqTooManyConnections, pqAdminShutdown:
+			return true
+		}
+		return false
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RetryPolicy controls how many times a transient failure is retried
+// and how long to wait in between, doubling the delay on every attempt
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy is used by NewDB
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, BaseDelay: 50 * time.Millisecond, MaxDelay: time.Second}
+
+// backoff returns the delay before retrying after the given attempt, counted from 0, with jitter
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << uint(attempt)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// CircuitBreaker stops sending queries to the database after Threshold consecutive transient failures.
+// Once Cooldown has passed, queries are let through again and the first success closes the circuit.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+// Allow reports whether a query could be sent to the database
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures < b.Threshold || time.Since(b.openedAt) >= b.Cooldown
+}
+
+// Record updates the circuit with the outcome of a query
+func (b *CircuitBreaker) Record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.Threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// errUnavailable is returned while the database is considered unhealthy
+var errUnavailable = NewError(ErrUnavailable, "Service Unavailable", nil)
+
+// do runs op, retrying it on transient failures, and fails fast while the circuit is open
+func (db *DB) do(op func() error) error {
+
+	if db.Breaker != nil && !db.Breaker.Allow() {
+		return errUnavailable
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = op()
+		if !isTransient(err) || attempt+1 >= db.Retry.Attempts {
+			break
+		}
+		time.Sleep(db.Retry.backoff(attempt))
+	}
+
+	transient := isTransient(err)
+	if db.Breaker != nil {
+		db.Breaker.Record(transient)
+	}
+	if transient {
+		return NewError(ErrUnavailable, "Service Unavailable", err)
+	}
+	return err
+}
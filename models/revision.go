@@ -0,0 +1,236 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Revision is a snapshot of a record, taken when the record is created and every time it is updated or replaced.
+// Revisions are kept in the RevisionTable of the resource, with the columns
+// revision_id (auto-increment), the primary key of the resource, revision (numbered from 1 for every record,
+// unique along with the primary key), snapshot (the JSON of the record), updated_by and updated_at.
+type Revision struct {
+	Number    int64       `json:"revision" db:"revision"`
+	RecordID  string      `json:"id" db:"record_id"`
+	Record    TableStruct `json:"record,omitempty" db:"-"`
+	Snapshot  []byte      `json:"-" db:"snapshot"`
+	UpdatedBy NullString  `json:"updated_by" db:"updated_by"`
+	UpdatedAt NullTime    `json:"updated_at" db:"updated_at"`
+}
+
+// Change is a field which differs between two revisions
+type Change struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// errNoRevisions is returned for the revisions of resources which don't keep any
+var errNoRevisions = NewError(ErrValidation, "Revisions Are Not Kept", nil)
+
+// Diff lists the fields whose values differ from one revision to the other, in alphabetical order.
+// A zero from Revision stands for the record before it was created, with every field unset.
+// The version is left out, as it changes on every write and is the UpdatedAt of the revisions already.
+func Diff(from, to Revision) ([]Change, error) {
+
+	before, err := fieldsOf(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := fieldsOf(to)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(after))
+	for name := range after {
+		names = append(names, name)
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := make([]Change, 0)
+	for _, name := range names {
+		if name != versionColumn && !reflect.DeepEqual(before[name], after[name]) {
+			changes = append(changes, Change{Field: name, From: before[name], To: after[name]})
+		}
+	}
+	return changes, nil
+}
+
+// fieldsOf decodes the snapshot of rev into its fields
+func fieldsOf(rev Revision) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if len(rev.Snapshot) == 0 {
+		return fields, nil
+	}
+	if err := json.Unmarshal(rev.Snapshot, &fields); err != nil {
+		return nil, internalError(err)
+	}
+	return fields, nil
+}
+
+// RestoredFrom returns the record held by rev, with updated_at cleared
+// so that PrepareUpdate stamps it as a new version
+func (r Resource) RestoredFrom(rev Revision) (TableStruct, error) {
+
+	v := reflect.New(r.typ)
+	if err := json.Unmarshal(rev.Snapshot, v.Interface()); err != nil {
+		return nil, internalError(err)
+	}
+	if i := r.field(versionColumn); i >= 0 {
+		v.Elem().Field(i).Set(reflect.ValueOf(NullTime{}))
+	}
+	return v.Elem().Interface().(TableStruct), nil
+}
+
+// recordRevision snapshots the stored record identified by id into the revision table of r,
+// numbered after the latest revision of the record. The writes calling it hold the record,
+// so that no other revision of it is recorded in between.
+func recordRevision(db Runner, r Resource, id string) error {
+
+	stored, err := getFromTable(db, r.WithID(id))
+	if err != nil {
+		return err
+	}
+	snapshot, err := json.Marshal(stored)
+	if err != nil {
+		return internalError(err)
+	}
+	updatedBy := NullString{}
+	if i := r.field("updated_by"); i >= 0 {
+		updatedBy, _ = reflect.ValueOf(stored).Field(i).Interface().(NullString)
+	}
+	updatedAt := NullTime{}
+	if version, ok := r.Version(stored); ok {
+		updatedAt = NullTime{Time: version, Valid: true}
+	}
+	var number int64
+	query := fmt.Sprintf("SELECT COALESCE(MAX(revision), 0) + 1 FROM %s WHERE %s = ?", r.RevisionTable, r.PrimaryKey)
+	if err := db.QueryRow(db.Rebind(query), id).Scan(&number); err != nil {
+		return internalError(err)
+	}
+	query = fmt.Sprintf("INSERT INTO %s (%s, revision, snapshot, updated_by, updated_at) VALUES (?, ?, ?, ?, ?)", r.RevisionTable, r.PrimaryKey)
+	if _, err := db.Exec(db.Rebind(query), id, number, snapshot, updatedBy, updatedAt); err != nil {
+		return internalError(err)
+	}
+	return nil
+}
+
+// revisionTableColumns lists the columns of the revision table of r
+func revisionTableColumns(r Resource) []string {
+	return []string{"revision_id", r.PrimaryKey, "revision", "snapshot", "updated_by", "updated_at"}
+}
+
+// revisionColumns selects the columns of a revision table into a Revision
+func revisionColumns(r Resource) string {
+	return fmt.Sprintf("revision, %s AS record_id, snapshot, updated_by, updated_at", r.PrimaryKey)
+}
+
+// listRevisions returns a page of the revisions of the record item identifies, newest first,
+// along with how many there are. The snapshots are left out.
+func listRevisions(db Runner, item TableStruct, limit int, offset int) ([]Revision, int, error) {
+
+	r, err := ResourceOf(item)
+	if err != nil {
+		return nil, 0, err
+	}
+	if r.RevisionTable == "" {
+		return nil, 0, errNoRevisions
+	}
+	var total int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ?", r.RevisionTable, r.PrimaryKey)
+	if err := db.QueryRow(db.Rebind(query), r.IDOf(item)).Scan(&total); err != nil {
+		return nil, 0, internalError(err)
+	}
+	revisions := []Revision{}
+	query = fmt.Sprintf("SELECT %s FROM %s WHERE %s = ? ORDER BY revision DESC LIMIT ? OFFSET ?", revisionColumns(r), r.RevisionTable, r.PrimaryKey)
+	if err := db.Select(&revisions, db.Rebind(query), r.IDOf(item), limit, offset); err != nil {
+		return nil, 0, internalError(err)
+	}
+	for i := range revisions {
+		revisions[i].Snapshot = nil
+	}
+	return revisions, total, nil
+}
+
+// getRevision returns a revision of the record item identifies, along with the record it holds.
+// If previous is set it returns the revision right before number instead, or a zero Revision if there is none.
+func getRevision(db Runner, item TableStruct, number int64, previous bool) (Revision, error) {
+
+	rev := Revision{}
+	r, err := ResourceOf(item)
+	if err != nil {
+		return rev, err
+	}
+	if r.RevisionTable == "" {
+		return rev, errNoRevisions
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ? AND revision = ?", revisionColumns(r), r.RevisionTable, r.PrimaryKey)
+	if previous {
+		query = fmt.Sprintf("SELECT %s FROM %s WHERE %s = ? AND revision < ? ORDER BY revision DESC LIMIT 1", revisionColumns(r), r.RevisionTable, r.PrimaryKey)
+	}
+	err = db.QueryRowx(db.Rebind(query), r.IDOf(item), number).StructScan(&rev)
+	switch {
+	case err == sql.ErrNoRows && previous:
+		return Revision{}, nil
+	case err == sql.ErrNoRows:
+		return rev, NewError(ErrNotFound, "Revision Not Found", err)
+	case err != nil:
+		return rev, internalError(err)
+	}
+	v := reflect.New(r.typ)
+	if err := json.Unmarshal(rev.Snapshot, v.Interface()); err != nil {
+		return rev, internalError(err)
+	}
+	rev.Record = v.Elem().Interface().(TableStruct)
+	return rev, nil
+}
+
+// ListRevisions returns a page of the revisions of the record item identifies, newest first,
+// along with how many there are
+func (db *DB) ListRevisions(item TableStruct, limit int, offset int) (revisions []Revision, total int, err error) {
+	err = db.do(func() (err error) {
+		revisions, total, err = listRevisions(db, item, limit, offset)
+		return err
+	})
+	return revisions, total, err
+}
+
+// GetRevision returns a revision of the record item identifies
+func (db *DB) GetRevision(item TableStruct, number int64) (rev Revision, err error) {
+	err = db.do(func() (err error) {
+		rev, err = getRevision(db, item, number, false)
+		return err
+	})
+	return rev, err
+}
+
+// GetPreviousRevision returns the revision of the record item identifies right before number,
+// or a zero Revision if number is the first one
+func (db *DB) GetPreviousRevision(item TableStruct, number int64) (rev Revision, err error) {
+	err = db.do(func() (err error) {
+		rev, err = getRevision(db, item, number, true)
+		return err
+	})
+	return rev, err
+}
+
+func (t *txDB) ListRevisions(item TableStruct, limit int, offset int) ([]Revision, int, error) {
+	return listRevisions(t.tx, item, limit, offset)
+}
+
+func (t *txDB) GetRevision(item TableStruct, number int64) (Revision, error) {
+	return getRevision(t.tx, item, number, false)
+}
+
+func (t *txDB) GetPreviousRevision(item TableStruct, number int64) (Revision, error) {
+	return getRevision(t.tx, item, number, true)
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SchemaMismatch reports how the table of a resource, or the table it keeps its revisions or the audit log in,
+// differs from the db tags of its model.
+// Missing columns are tagged on the model but absent from the table, so reads and writes of them fail.
+// A table which doesn't exist misses every column.
+// Unknown columns are in the table but not on the model; queries list their columns, so these are ignored.
+type SchemaMismatch struct {
+	Resource string
+	Table    string
+	Missing  []string
+	Unknown  []string
+}
+
+// Breaking reports whether the mismatch makes queries on the table fail
+func (m SchemaMismatch) Breaking() bool {
+	return len(m.Missing) > 0
+}
+
+func (m SchemaMismatch) String() string {
+	report := make([]string, 0, 2)
+	if len(m.Missing) > 0 {
+		report = append(report, "missing columns "+strings.Join(m.Missing, ", "))
+	}
+	if len(m.Unknown) > 0 {
+		report = append(report, "unknown columns "+strings.Join(m.Unknown, ", "))
+	}
+	return fmt.Sprintf("%s (table %s): %s", m.Resource, m.Table, strings.Join(report, "; "))
+}
+
+// compareColumns matches the columns of the table of r against the db tags of its model.
+// The mismatch is empty if they agree.
+func compareColumns(r Resource, columns []string) SchemaMismatch {
+	return compareTable(r.Name, r.Table, r.Columns(), columns)
+}
+
+// compareTable matches the columns of table against those expected
+func compareTable(resource string, table string, expected []string, columns []string) SchemaMismatch {
+
+	mismatch := SchemaMismatch{Resource: resource, Table: table}
+	inTable := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		inTable[column] = true
+	}
+	tagged := make(map[string]bool)
+	for _, column := range expected {
+		tagged[column] = true
+		if !inTable[column] {
+			mismatch.Missing = append(mismatch.Missing, column)
+		}
+	}
+	for _, column := range columns {
+		if !tagged[column] {
+			mismatch.Unknown = append(mismatch.Unknown, column)
+		}
+	}
+	sort.Strings(mismatch.Unknown)
+	return mismatch
+}
+
+// ValidateSchema compares the tables of every registered resource, as described by the database,
+// against the db tags of their models, and returns the mismatches found.
+// The revision tables are checked as well, and so is the audit log unless auditing is off.
+func (db *DB) ValidateSchema() ([]SchemaMismatch, error) {
+
+	type table struct {
+		resource string
+		name     string
+		columns  []string
+	}
+	tables := make([]table, 0)
+	for _, r := range Resources() {
+		tables = append(tables, table{r.Name, r.Table, r.Columns()})
+		if r.RevisionTable != "" {
+			tables = append(tables, table{r.Name, r.RevisionTable, revisionTableColumns(r)})
+		}
+	}
+	if db.Audit {
+		tables = append(tables, table{"audit", "audit_log", auditColumns()})
+	}
+
+	mismatches := make([]SchemaMismatch, 0)
+	for _, t := range tables {
+		columns := []string{}
+		if err := db.Select(&columns, db.Rebind(dialectOf(db).columnsQuery), t.name); err != nil {
+			return nil, err
+		}
+		if m := compareTable(t.resource, t.name, t.columns, columns); len(m.Missing) > 0 || len(m.Unknown) > 0 {
+			mismatches = append(mismatches, m)
+		}
+	}
+	return mismatches, nil
+}
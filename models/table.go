@@ -0,0 +1,227 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// The helpers below implement TableStruct for any registered resource,
+// using the table and primary key the resource was registered with.
+
+// getFromTable fetches the record identified by the primary key of item
+func getFromTable(db Runner, item TableStruct) (TableStruct, error) {
+
+	r, err := ResourceOf(item)
+	if err != nil {
+		return nil, err
+	}
+	row := reflect.New(r.typ)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", r.selectColumns(), r.Table, r.PrimaryKey)
+	err = db.QueryRowx(db.Rebind(query), r.IDOf(item)).StructScan(row.Interface())
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, NewError(ErrNotFound, r.NotFound, err)
+	case err != nil:
+		return nil, internalError(err)
+	}
+	return row.Elem().Interface().(TableStruct), nil
+}
+
+// insertIntoTable writes item as a new record
+func insertIntoTable(db Runner, item TableStruct) error {
+
+	r, err := ResourceOf(item)
+	if err != nil {
+		return err
+	}
+	query, err := generateSQLStmt(item, "insert", r.Table)
+	if err != nil {
+		return internalError(errors.New("Generate SQL statement failed"))
+	}
+	result, err := db.NamedExec(query, item)
+	if err != nil {
+		if dialectOf(db).isDuplicate(err) {
+			return NewError(ErrConflict, r.Conflict, err)
+		}
+		return internalError(err)
+	}
+	rowCnt, err := result.RowsAffected()
+	if err != nil {
+		return internalError(err)
+	}
+	if rowCnt > 1 {
+		return internalError(errors.New("More Than One Rows Affected"))
+	} else if rowCnt == 0 {
+		return internalError(errors.New("No Row Inserted"))
+	}
+	if r.RevisionTable != "" {
+		return recordRevision(db, r, r.IDOf(item))
+	}
+	return nil
+}
+
+// updateTable writes the fields set on item to the record with the same primary key
+func updateTable(db Runner, item TableStruct) error {
+	return execUpdate(db, item, "partial_update")
+}
+
+// replaceInTable overwrites the record with the same primary key with item
+func replaceInTable(db Runner, item TableStruct) error {
+	return execUpdate(db, item, "full_update")
+}
+
+func execUpdate(db Runner, item TableStruct, mode string) error {
+
+	r, err := ResourceOf(item)
+	if err != nil {
+		return err
+	}
+	if i := r.field(versionColumn); i >= 0 {
+		next, err := nextVersion(db, r, r.IDOf(item))
+		if err != nil {
+			return err
+		}
+		v := reflect.New(r.typ).Elem()
+		v.Set(reflect.ValueOf(item))
+		v.Field(i).Set(reflect.ValueOf(NullTime{Time: next, Valid: true}))
+		item = v.Interface().(TableStruct)
+	} else if len(versionsOf(db)) > 0 {
+		// No ETag is issued for records without a version
+		return errVersionMismatch
+	}
+	query, err := generateSQLStmt(item, mode, r.Table)
+	if err != nil {
+		return internalError(errors.New("Generate SQL statement failed"))
+	}
+	result, err := db.NamedExec(query, item)
+	if err != nil {
+		return internalError(err)
+	}
+	rowCnt, err := result.RowsAffected()
+	if err != nil {
+		return internalError(err)
+	}
+	if rowCnt > 1 {
+		return internalError(errors.New("More Than One Rows Affected"))
+	} else if rowCnt == 0 {
+		return NewError(ErrNotFound, r.NotFound, nil)
+	}
+	if r.RevisionTable != "" {
+		return recordRevision(db, r, r.IDOf(item))
+	}
+	return nil
+}
+
+// deleteFromTable deactivates the record identified by the primary key of item,
+// stamping updated_at so that purges can tell how long it has been in the trash.
+// Resources without an active column are deleted for real.
+func deleteFromTable(db Runner, item TableStruct) error {
+
+	r, err := ResourceOf(item)
+	if err != nil {
+		return err
+	}
+	var next time.Time
+	if r.field(versionColumn) >= 0 {
+		if next, err = nextVersion(db, r, r.IDOf(item)); err != nil {
+			return err
+		}
+	} else if len(versionsOf(db)) > 0 {
+		return errVersionMismatch
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s = ?", r.Table, activeColumn, r.inactive(), r.PrimaryKey)
+	args := []interface{}{r.IDOf(item)}
+	if r.field(activeColumn) < 0 {
+		query = fmt.Sprintf("DELETE FROM %s WHERE %s = ?", r.Table, r.PrimaryKey)
+	} else if r.field(versionColumn) >= 0 {
+		query = fmt.Sprintf("UPDATE %s SET %s = %s, %s = ? WHERE %s = ?", r.Table, activeColumn, r.inactive(), versionColumn, r.PrimaryKey)
+		args = []interface{}{next, r.IDOf(item)}
+	}
+	result, err := db.Exec(db.Rebind(query), args...)
+	if err != nil {
+		return internalError(err)
+	}
+	if rowCnt, err := result.RowsAffected(); err != nil {
+		return internalError(err)
+	} else if rowCnt == 0 {
+		return NewError(ErrNotFound, r.NotFound, nil)
+	}
+	return nil
+}
+
+// insertManyIntoTable writes items, all records of the same resource, with multi-row INSERTs.
+// Absent fields are left to the column defaults, so items are grouped by the columns they hold
+// and each group takes one statement.
+func insertManyIntoTable(db Runner, items []TableStruct) error {
+
+	if len(items) == 0 {
+		return nil
+	}
+	r, err := ResourceOf(items[0])
+	if err != nil {
+		return err
+	}
+
+	type group struct {
+		columns []string
+		rows    [][]interface{}
+	}
+	groups := make(map[string]*group)
+	order := make([]string, 0)
+	for _, item := range items {
+		if reflect.TypeOf(item) != r.typ {
+			return internalError(fmt.Errorf("%T is not a %s", item, r.typ))
+		}
+		v := reflect.ValueOf(item)
+		columns, row := make([]string, 0, v.NumField()), make([]interface{}, 0, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			if isPresent, tracked := present(v.Field(i).Interface()); tracked && !isPresent {
+				continue
+			}
+			columns = append(columns, r.typ.Field(i).Tag.Get("db"))
+			row = append(row, v.Field(i).Interface())
+		}
+		key := strings.Join(columns, ",")
+		if _, ok := groups[key]; !ok {
+			groups[key] = &group{columns: columns}
+			order = append(order, key)
+		}
+		groups[key].rows = append(groups[key].rows, row)
+	}
+
+	for _, key := range order {
+		g := groups[key]
+		placeholders := "(?" + strings.Repeat(", ?", len(g.columns)-1) + ")"
+		// Stay under the limit of placeholders in a single prepared statement
+		chunk := dialectOf(db).maxPlaceholders / len(g.columns)
+		for start := 0; start < len(g.rows); start += chunk {
+			rows := g.rows[start:]
+			if len(rows) > chunk {
+				rows = rows[:chunk]
+			}
+			values := make([]interface{}, 0, len(rows)*len(g.columns))
+			for _, row := range rows {
+				values = append(values, row...)
+			}
+			query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s%s", r.Table, key, placeholders, strings.Repeat(", "+placeholders, len(rows)-1))
+			if _, err := db.Exec(db.Rebind(query), values...); err != nil {
+				if dialectOf(db).isDuplicate(err) {
+					return NewError(ErrConflict, r.Conflict, err)
+				}
+				return internalError(err)
+			}
+		}
+	}
+	if r.RevisionTable != "" {
+		for _, item := range items {
+			if err := recordRevision(db, r, r.IDOf(item)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Deleting a record of a resource with an active column only deactivates it,
+// stamping updated_at, and moves it to the trash until it is restored or purged.
+const activeColumn = "active"
+
+// Visibility tells which records a list holds, as far as their resource has an active column
+type Visibility int
+
+const (
+	// ActiveOnly lists records which are not in the trash
+	ActiveOnly Visibility = iota
+	// WithInactive lists every record
+	WithInactive
+	// InactiveOnly lists the trash
+	InactiveOnly
+)
+
+// visibilityCondition is the predicate selecting the records of r visible at v, or "" for all of them
+func (r Resource) visibilityCondition(v Visibility) string {
+	if r.field(activeColumn) < 0 {
+		return ""
+	}
+	switch v {
+	case ActiveOnly:
+		return fmt.Sprintf("(%s IS NULL OR %s <> %s)", activeColumn, activeColumn, r.inactive())
+	case InactiveOnly:
+		return fmt.Sprintf("%s = %s", activeColumn, r.inactive())
+	}
+	return ""
+}
+
+// inactive is the literal of the active column of a record in the trash.
+// PostgreSQL doesn't compare booleans with integers, so boolean columns take FALSE,
+// which MySQL and SQLite read as 0 as well.
+func (r Resource) inactive() string {
+	if i := r.field(activeColumn); i >= 0 && r.typ.Field(i).Type == reflect.TypeOf(NullBool{}) {
+		return "FALSE"
+	}
+	return "0"
+}
+
+// Inactive reports whether item is in the trash
+func (r Resource) Inactive(item TableStruct) bool {
+
+	i := r.field(activeColumn)
+	if i < 0 {
+		return false
+	}
+	switch active := reflect.ValueOf(item).Field(i).Interface().(type) {
+	case NullInt:
+		return active.Valid && active.Int == 0
+	case NullBool:
+		return active.Valid && !active.Bool
+	}
+	return false
+}
+
+// Restored returns the partial update taking the record identified by id out of the trash
+func (r Resource) Restored(id string) (TableStruct, error) {
+
+	i := r.field(activeColumn)
+	if i < 0 {
+		return nil, NewError(ErrValidation, "Records Cannot Be Restored", nil)
+	}
+	v := reflect.New(r.typ).Elem()
+	v.Set(reflect.ValueOf(r.WithID(id)))
+	switch v.Field(i).Interface().(type) {
+	case NullInt:
+		v.Field(i).Set(reflect.ValueOf(NullInt{Int: 1, Valid: true}))
+	case NullBool:
+		v.Field(i).Set(reflect.ValueOf(NullBool{Bool: true, Valid: true}))
+	default:
+		return nil, internalError(fmt.Errorf("%s of %s is neither NullInt nor NullBool", activeColumn, r.typ))
+	}
+	return r.PrepareUpdate(v.Interface().(TableStruct)), nil
+}
+
+// trashedSince returns the records of r which have been in the trash since before, locked for the rest of the transaction
+func trashedSince(db Runner, r Resource, before time.Time) ([]TableStruct, error) {
+
+	if r.field(activeColumn) < 0 || r.field(versionColumn) < 0 {
+		return nil, NewError(ErrValidation, "Records Cannot Be Purged", nil)
+	}
+	rows := reflect.New(reflect.SliceOf(r.typ))
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s AND %s < ?%s", r.selectColumns(), r.Table, activeColumn, r.inactive(), versionColumn, dialectOf(db).lockRows)
+	if err := db.Select(rows.Interface(), db.Rebind(query), before.UTC()); err != nil {
+		return nil, internalError(err)
+	}
+	records := make([]TableStruct, rows.Elem().Len())
+	for i := range records {
+		records[i] = rows.Elem().Index(i).Interface().(TableStruct)
+	}
+	return records, nil
+}
+
+// purgeFromTable deletes for real the records of the resource item belongs to
+// which have been in the trash since before, and returns how many there were.
+// before is taken in UTC, as the versions are, so that SQLite compares them right.
+func purgeFromTable(db Runner, item TableStruct, before time.Time) (int64, error) {
+
+	r, err := ResourceOf(item)
+	if err != nil {
+		return 0, err
+	}
+	if r.field(activeColumn) < 0 || r.field(versionColumn) < 0 {
+		return 0, NewError(ErrValidation, "Records Cannot Be Purged", nil)
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = %s AND %s < ?", r.Table, activeColumn, r.inactive(), versionColumn)
+	result, err := db.Exec(db.Rebind(query), before.UTC())
+	if err != nil {
+		return 0, internalError(err)
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, internalError(err)
+	}
+	return purged, nil
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// WithTx runs fn as a unit of work: every call fn makes on the given Datastore shares one transaction,
+// which is committed if fn returns nil and rolled back otherwise.
+// The writes of the transaction are conditioned on the versions of IfMatch, if any,
+// and logged as made by the Caller of As.
+// The whole transaction is retried on transient failures such as deadlocks,
+// so fn should have no side effects outside of the Datastore.
+func (db *DB) WithTx(fn func(Datastore) error) error {
+	return db.do(func() (err error) {
+
+		tx, err := db.Beginx()
+		if err != nil {
+			return internalError(err)
+		}
+		defer func() {
+			if p := recover(); p != nil {
+				tx.Rollback()
+				panic(p)
+			}
+		}()
+
+		if err = fn(&txDB{tx: tx, ifMatch: db.ifMatch, caller: db.caller, audit: db.Audit}); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return internalError(err)
+		}
+		db.wrote()
+		return nil
+	})
+}
+
+// txDB is the Datastore handed to WithTx callbacks.
+// Failures are not retried one by one, as a failed statement may have aborted the whole transaction;
+// they are returned so that WithTx could roll back and retry.
+type txDB struct {
+	tx      *sqlx.Tx
+	ifMatch []time.Time
+	caller  Caller
+	audit   bool
+}
+
+func (t *txDB) Get(item TableStruct) (TableStruct, error) {
+	if _, err := ResourceOf(item); err != nil {
+		return nil, err
+	}
+	return item.GetFromDatabase(t.tx)
+}
+
+func (t *txDB) Create(item TableStruct) (interface{}, error) {
+	if _, err := ResourceOf(item); err != nil {
+		return nil, err
+	}
+	if err := t.audited(AuditCreate, item, func() error { return item.InsertIntoDatabase(t.tx) }); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (t *txDB) CreateMany(items []TableStruct) error {
+	if err := insertManyIntoTable(t.tx, items); err != nil {
+		return err
+	}
+	if t.audit {
+		return auditedMany(t.tx, t.caller, items)
+	}
+	return nil
+}
+
+func (t *txDB) Update(item TableStruct) (interface{}, error) {
+	if _, err := ResourceOf(item); err != nil {
+		return nil, err
+	}
+	return nil, t.audited(AuditUpdate, item, func() error { return item.UpdateDatabase(t.runner()) })
+}
+
+func (t *txDB) Replace(item TableStruct) (interface{}, error) {
+	if _, err := ResourceOf(item); err != nil {
+		return nil, err
+	}
+	if err := t.audited(AuditReplace, item, func() error { return item.ReplaceInDatabase(t.runner()) }); err != nil {
+		return nil, err
+	}
+	// The record is read back for what the write left to the database, such as the version it stamped
+	return item.GetFromDatabase(t.tx)
+}
+
+func (t *txDB) Delete(item TableStruct) (interface{}, error) {
+	if _, err := ResourceOf(item); err != nil {
+		return nil, err
+	}
+	if err := t.audited(AuditDelete, item, func() error { return item.DeleteFromDatabase(t.runner()) }); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// audited runs write, logging it in the audit log unless auditing is off
+func (t *txDB) audited(operation string, item TableStruct, write func() error) error {
+	if !t.audit {
+		return write()
+	}
+	return audited(t.tx, t.caller, operation, item, write)
+}
+
+func (t *txDB) List(item TableStruct, args ListArgs) (ListResult, error) {
+	if _, err := ResourceOf(item); err != nil {
+		return ListResult{Items: []TableStruct{}}, err
+	}
+	return item.ListFromDatabase(t.tx, args)
+}
+
+func (t *txDB) Purge(item TableStruct, before time.Time) (int64, error) {
+	if _, err := ResourceOf(item); err != nil {
+		return 0, err
+	}
+	if !t.audit {
+		return item.PurgeFromDatabase(t.tx, before)
+	}
+	return auditedPurge(t.tx, t.caller, item, before)
+}
+
+func (t *txDB) ListAudit(q AuditQuery) ([]AuditEntry, int, error) {
+	return listAudit(t.tx, q)
+}
+
+// As makes the writes of the transaction in progress on behalf of caller
+func (t *txDB) As(caller Caller) Datastore {
+	scoped := *t
+	scoped.caller = caller
+	return &scoped
+}
+
+// WithTx joins the transaction in progress
+func (t *txDB) WithTx(fn func(Datastore) error) error {
+	return fn(t)
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Records are versioned by their updated_at column, which is what entity tags are derived from.
+// Stamps are taken to the second, so that they survive DATETIME columns unchanged,
+// and every write moves a record past its previous version, so that two writes within a second still tell apart.
+const versionColumn = "updated_at"
+
+// stamp returns the version of a record written now. It is taken in UTC, as SQLite compares times
+// as strings holding their offset, so that versions compare equal whatever the zone of the server.
+func stamp() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// errVersionMismatch is returned by the writes of a Datastore from IfMatch
+// when the record has been modified since the client read it
+var errVersionMismatch = NewError(ErrConcurrency, "Version Mismatch", nil)
+
+// ETag returns the strong entity tag of item, or "" if the record has never been stamped
+func (r Resource) ETag(item TableStruct) string {
+	version, ok := r.Version(item)
+	if !ok {
+		return ""
+	}
+	return `"` + strconv.FormatInt(version.UnixNano(), 36) + `"`
+}
+
+// Version returns the updated_at of item, if it has one
+func (r Resource) Version(item TableStruct) (time.Time, bool) {
+	i := r.field(versionColumn)
+	if i < 0 {
+		return time.Time{}, false
+	}
+	t, ok := reflect.ValueOf(item).Field(i).Interface().(NullTime)
+	return t.Time, ok && t.Valid
+}
+
+// setVersion stamps the version of the record held by v, if the resource is versioned
+func (r Resource) setVersion(v reflect.Value) {
+	if i := r.field(versionColumn); i >= 0 {
+		if _, ok := v.Field(i).Interface().(NullTime); ok {
+			v.Field(i).Set(reflect.ValueOf(NullTime{Time: stamp(), Valid: true}))
+		}
+	}
+}
+
+// ParseETags returns the versions the entity tags of an If-Match header were derived from.
+// Tags which weren't issued by ETag, weak ones included, can't match any record,
+// so a header holding nothing else fails with ErrConcurrency.
+func ParseETags(header string) ([]time.Time, error) {
+
+	versions := make([]time.Time, 0)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		nanos, err := strconv.ParseInt(tag[1:len(tag)-1], 36, 64)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, time.Unix(0, nanos).UTC())
+	}
+	if len(versions) == 0 {
+		return nil, errVersionMismatch
+	}
+	return versions, nil
+}
+
+// conditionalRunner is the Runner of a Datastore from IfMatch.
+// Updates and deletes made through it only apply to a record at one of versions.
+type conditionalRunner struct {
+	Runner
+	versions []time.Time
+}
+
+// versionsOf returns the versions a write on db is conditioned on, if any
+func versionsOf(db Runner) []time.Time {
+	if c, ok := db.(conditionalRunner); ok {
+		return c.versions
+	}
+	return nil
+}
+
+// nextVersion locks the record identified by id for the rest of the transaction, checks it against the versions
+// of a conditional write on db, if any, and returns the version to write: now, or a second past its version if later
+func nextVersion(db Runner, r Resource, id string) (time.Time, error) {
+
+	var current NullTime
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?%s", versionColumn, r.Table, r.PrimaryKey, dialectOf(db).lockRows)
+	err := db.QueryRowx(db.Rebind(query), id).Scan(&current)
+	switch {
+	case err == sql.ErrNoRows:
+		return time.Time{}, NewError(ErrNotFound, r.NotFound, err)
+	case err != nil:
+		return time.Time{}, internalError(err)
+	}
+	if versions := versionsOf(db); len(versions) > 0 && !matchesVersion(current, versions) {
+		return time.Time{}, errVersionMismatch
+	}
+	next := stamp()
+	if current.Valid && !next.After(current.Time) {
+		next = current.Time.UTC().Truncate(time.Second).Add(time.Second)
+	}
+	return next, nil
+}
+
+// matchesVersion reports whether a record at version is at one of versions
+func matchesVersion(version NullTime, versions []time.Time) bool {
+	for _, v := range versions {
+		if version.Valid && version.Time.Equal(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// IfMatch returns a Datastore whose updates, replaces and deletes only apply to a record
+// still at one of versions, and fail with ErrConcurrency otherwise.
+// The writes are run by the txDB of WithTx, which hands the versions down to the TableStruct methods.
+func (db *DB) IfMatch(versions ...time.Time) Datastore {
+	conditional := *db
+	conditional.ifMatch = versions
+	return &conditional
+}
+
+// IfMatch conditions the writes of the transaction in progress
+func (t *txDB) IfMatch(versions ...time.Time) Datastore {
+	conditional := *t
+	conditional.ifMatch = versions
+	return &conditional
+}
+
+func (t *txDB) runner() Runner {
+	if len(t.ifMatch) > 0 {
+		return conditionalRunner{t.tx, t.ifMatch}
+	}
+	return t.tx
+}
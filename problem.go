@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/readr-media/readr-restful/models"
+)
+
+// problem is an RFC 7807 problem details body.
+// Code is a stable identifier of the kind of error for clients to switch on.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+}
+
+// Kinds of errors of the API itself, on top of those of the models package
+var (
+	errUnauthorized = errors.New("unauthorized")
+	errForbidden    = errors.New("forbidden")
+)
+
+// problemKinds maps error kinds to HTTP statuses and error codes
+var problemKinds = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{models.ErrNotFound, http.StatusNotFound, "not_found"},
+	{models.ErrConflict, http.StatusConflict, "conflict"},
+	{models.ErrValidation, http.StatusBadRequest, "validation_failed"},
+	{models.ErrConcurrency, http.StatusPreconditionFailed, "precondition_failed"},
+	{models.ErrPreconditionRequired, http.StatusPreconditionRequired, "precondition_required"},
+	{models.ErrUnavailable, http.StatusServiceUnavailable, "service_unavailable"},
+	{models.ErrAborted, http.StatusFailedDependency, "aborted"},
+	{errUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{errForbidden, http.StatusForbidden, "forbidden"},
+}
+
+// newProblem describes err for clients.
+// Errors of unknown kinds are logged and reported as internal errors without their details.
+func newProblem(err error) problem {
+
+	p := problem{Type: "about:blank", Status: http.StatusInternalServerError, Code: "internal_error"}
+	for _, k := range problemKinds {
+		if errors.Is(err, k.kind) {
+			p.Status, p.Code = k.status, k.code
+			break
+		}
+	}
+
+	var e *models.Error
+	if p.Status == http.StatusInternalServerError || !errors.As(err, &e) {
+		log.Printf("Internal Server Error: %v\n", err)
+		p.Detail = "Internal Server Error"
+	} else {
+		p.Detail = e.Message
+	}
+	p.Title = http.StatusText(p.Status)
+	return p
+}
+
+// abortWithError writes err as an application/problem+json response and stops the handler chain.
+// Error responses must not be cached, whatever the route is configured with.
+func abortWithError(c *gin.Context, err error) {
+
+	p := newProblem(err)
+	c.Header("Content-Type", "application/problem+json")
+	c.Header("Cache-Control", "no-store")
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// invalid reports a malformed request with message
+func invalid(c *gin.Context, message string) {
+	abortWithError(c, models.NewError(models.ErrValidation, message, nil))
+}
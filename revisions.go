@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/readr-media/readr-restful/models"
+)
+
+// bindRevision reads the revision number named by param
+func bindRevision(c *gin.Context, param string) (int64, error) {
+	number, err := strconv.ParseInt(c.Param(param), 10, 64)
+	if err != nil || number < 1 {
+		return 0, models.NewError(models.ErrNotFound, "Revision Not Found", nil)
+	}
+	return number, nil
+}
+
+// Revisions lists the revisions of a record, newest first
+func (h resourceHandlers) Revisions(c *gin.Context) {
+
+	limit, offset, err := bindPage(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	revisions, total, err := h.env.db.ListRevisions(h.res.WithID(c.Param("id")), limit, offset)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"_items": revisions,
+		"_meta":  listMeta{Total: total, Limit: limit, Offset: offset},
+	})
+}
+
+// Revision returns a revision along with the record it holds
+func (h resourceHandlers) Revision(c *gin.Context) {
+
+	number, err := bindRevision(c, "rev")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	rev, err := h.env.db.GetRevision(h.res.WithID(c.Param("id")), number)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rev)
+}
+
+// RevisionDiff lists the fields changed by a revision.
+// Changes are taken from the revision right before it, unless another one is given by ?from=
+func (h resourceHandlers) RevisionDiff(c *gin.Context) {
+
+	number, err := bindRevision(c, "rev")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	item := h.res.WithID(c.Param("id"))
+	to, err := h.env.db.GetRevision(item, number)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	var from models.Revision
+	if c.Query("from") != "" {
+		var fromNumber int64
+		if fromNumber, err = strconv.ParseInt(c.Query("from"), 10, 64); err != nil {
+			abortWithError(c, models.NewError(models.ErrValidation, "Invalid from", nil))
+			return
+		}
+		from, err = h.env.db.GetRevision(item, fromNumber)
+	} else {
+		from, err = h.env.db.GetPreviousRevision(item, number)
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	changes, err := models.Diff(from, to)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"from": from.Number, "to": to.Number, "changes": changes})
+}
+
+// RestoreRevision replaces a record with one of its revisions, which records a new revision in turn.
+// The body, if any, is merged into the restored record, e.g. to set updated_by.
+func (h resourceHandlers) RestoreRevision(c *gin.Context) {
+
+	ds, err := h.conditional(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	number, err := bindRevision(c, "rev")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	rev, err := h.env.db.GetRevision(h.res.WithID(c.Param("id")), number)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	item, err := h.res.RestoredFrom(rev)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		abortWithError(c, models.NewError(models.ErrValidation, h.res.Invalid, err))
+		return
+	}
+	if len(body) > 0 {
+		item, err = h.res.Patch(item, models.MergePatchType, body)
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result, err := ds.Replace(h.res.PrepareUpdate(item))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	h.setValidators(c, result)
+	c.JSON(http.StatusOK, result)
+}
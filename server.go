@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,9 +20,31 @@ import (
 )
 
 var (
+	dbDriver   = flag.String("db-driver", "mysql", "Database to run on: mysql, postgres, sqlite3 for local development, or memory for demos")
+	sqlitePath = flag.String("sqlite-path", ":memory:", "Database file of the sqlite3 driver, in memory by default")
 	sqlUser    = flag.String("sql-user", "root", "User account to SQL server")
 	sqlAddress = flag.String("sql-address", "127.0.0.1:3306", "Address to the SQL server")
 	sqlAuth    = flag.String("sql-auth", "", "Password to SQL server")
+	sqlDB      = flag.String("sql-database", "memberdb", "Database of the SQL server")
+
+	maxOpenConns    = flag.Int("sql-max-open-conns", 25, "Most connections open to the SQL server, and to each replica, 0 for no limit")
+	maxIdleConns    = flag.Int("sql-max-idle-conns", 10, "Most idle connections kept open to the SQL server, and to each replica")
+	connMaxLifetime = flag.Duration("sql-conn-max-lifetime", 5*time.Minute, "Longest time a connection is reused, 0 for no limit")
+	connMaxIdleTime = flag.Duration("sql-conn-max-idle-time", 0, "Longest time a connection stays idle, 0 for no limit")
+
+	listen        = flag.String("listen", ":8080", "Address to listen on")
+	readTimeout   = flag.Duration("read-timeout", 30*time.Second, "Longest time to read a request, 0 for none")
+	writeTimeout  = flag.Duration("write-timeout", time.Minute, "Longest time to write a response, 0 for none")
+	shutdownDelay = flag.Duration("shutdown-delay", 5*time.Second, "How long the server keeps serving on SIGTERM, failing /readyz, before it stops accepting connections")
+	shutdownGrace = flag.Duration("shutdown-grace", 30*time.Second, "How long the requests in flight are given to complete on SIGTERM")
+
+	requireIfMatch = flag.Bool("require-if-match", false, "Reject updates and deletes without an If-Match header")
+	trashRetention = flag.Duration("trash-retention", 30*24*time.Hour, "How long deleted records stay in the trash before they can be purged")
+	auditLog       = flag.Bool("audit-log", true, "Log every write in the audit_log table")
+	adminToken     = flag.String("admin-token", "", "Bearer token of the admin endpoints, which are disabled if empty")
+	schemaCheck    = flag.String("schema-check", "strict", "Compare the tables against the models at startup: strict refuses to start on missing columns, warn only logs, off skips")
+	readYourWrites = flag.Duration("read-your-writes", models.DefaultStickyWindow, "How long the reads of a client go to the primary rather than the replicas after it writes")
+	cacheSize      = flag.Int("cache-size", 0, "Number of records held by the in-process read cache, which is disabled if 0")
 )
 
 // func sqlMiddleware(connString string) gin.HandlerFunc {
@@ -30,252 +59,402 @@ var (
 
 type Env struct {
 	db models.Datastore
+	// requireIfMatch rejects writes which aren't conditioned on the version the client read
+	requireIfMatch bool
+	// cacheControl maps route paths, e.g. /article/:id, to the Cache-Control directives of their GET responses
+	cacheControl cacheRules
+	// trashRetention is how long deleted records are kept before a purge removes them for good
+	trashRetention time.Duration
+	// adminToken guards the admin endpoints, see requireAdmin
+	adminToken string
+	// poolStats reports the connection pools of the database on /debug/db, which is disabled if nil
+	poolStats func() []models.PoolStats
+	// health checks the dependencies of the server for Readyz, and draining is set once it shuts down
+	health   func(context.Context) []models.Health
+	draining int32
 }
 
-func (env *Env) MemberGetHandler(c *gin.Context) {
+// listResponse is the envelope shared by every list endpoint
+type listResponse struct {
+	Items []models.TableStruct `json:"_items"`
+	Meta  listMeta             `json:"_meta"`
+}
 
-	input := models.Member{ID: c.Param("id")}
-	member, err := env.db.Get(input)
+type listMeta struct {
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Next   string `json:"next,omitempty"`
+	Prev   string `json:"prev,omitempty"`
+}
 
-	if err != nil {
-		switch err.Error() {
-		case "User Not Found":
-			c.JSON(http.StatusNotFound, gin.H{"Error": "User Not Found"})
-			return
-
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Internal Server Error"})
-			return
-		}
+func newListResponse(args models.ListArgs, result models.ListResult) listResponse {
+	return listResponse{
+		Items: result.Items,
+		Meta: listMeta{
+			Total:  result.Total,
+			Limit:  args.Limit,
+			Offset: args.Offset,
+			Next:   result.Next,
+			Prev:   result.Prev,
+		},
 	}
-	c.JSON(http.StatusOK, member)
 }
 
-func (env *Env) MemberPostHandler(c *gin.Context) {
+// bindPage reads the limit and offset of a list from the query string
+func bindPage(c *gin.Context) (limit int, offset int, err error) {
 
-	member := models.Member{}
-	c.Bind(&member)
-
-	// Pre-request test
-	if member.ID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid User"})
-		return
-	}
-	if !member.CreateTime.Valid {
-		member.CreateTime.Time = time.Now()
-		member.CreateTime.Valid = true
-	}
-	if !member.UpdatedAt.Valid {
-		member.UpdatedAt.Time = time.Now()
-		member.UpdatedAt.Valid = true
+	limit = models.DefaultListLimit
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > models.MaxListLimit {
+			return limit, offset, models.NewError(models.ErrValidation, "Invalid Limit", nil)
+		}
 	}
-
-	result, err := env.db.Create(member)
-	// var req models.Databox = &member
-	// result, err := req.Create()
-	if err != nil {
-		switch err.Error() {
-		case "Duplicate entry":
-			c.JSON(http.StatusBadRequest, gin.H{"Error": "User Already Existed"})
-			return
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Internal Server Error"})
-			return
+	if value := c.Query("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return limit, offset, models.NewError(models.ErrValidation, "Invalid Offset", nil)
 		}
 	}
-	c.JSON(http.StatusOK, result)
+	return limit, offset, nil
 }
 
-func (env *Env) MemberPutHandler(c *gin.Context) {
+// bindListArgs reads paging, sorting and filtering options from the query string.
+// Every parameter other than limit, offset, cursor, sort and include_inactive is treated as a filter on item.
+func (env *Env) bindListArgs(c *gin.Context, item models.TableStruct) (args models.ListArgs, err error) {
 
-	member := models.Member{}
-	c.Bind(&member)
-	// Use id field to check if Member Struct was binded successfully
-	// If the binding failed, id would be emtpy string
-	if member.ID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid Member Data"})
-		return
+	query := c.Request.URL.Query()
+	args = models.ListArgs{}
+	if args.Limit, args.Offset, err = bindPage(c); err != nil {
+		return args, err
 	}
-	if member.CreateTime.Valid {
-		member.CreateTime.Time = time.Time{}
-		member.CreateTime.Valid = false
-	}
-	if !member.UpdatedAt.Valid {
-		member.UpdatedAt.Time = time.Now()
-		member.UpdatedAt.Valid = true
+	if cursor := query.Get("cursor"); cursor != "" {
+		if args.Offset != 0 {
+			return args, models.NewError(models.ErrValidation, "Invalid Offset", nil)
+		}
+		if args.Cursor, err = models.ParseCursor(item, cursor); err != nil {
+			return args, err
+		}
 	}
-	// var req models.Databox = &member
-	// result, err := req.Update()
-	result, err := env.db.Update(member)
-	if err != nil {
-		switch err.Error() {
-		case "User Not Found":
-			c.JSON(http.StatusBadRequest, gin.H{"Error": "User Not Found"})
-			return
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Internal Server Error"})
-			return
+	if sort := query.Get("sort"); sort != "" {
+		if args.Sorts, err = models.ParseSort(item, sort); err != nil {
+			return args, err
 		}
 	}
-	c.JSON(http.StatusOK, result)
+	if args.Visibility, err = env.bindVisibility(c); err != nil {
+		return args, err
+	}
+	query.Del("limit")
+	query.Del("offset")
+	query.Del("cursor")
+	query.Del("sort")
+	query.Del("include_inactive")
+	args.Filters, err = models.ParseFilters(item, query)
+	return args, err
 }
 
-func (env *Env) MemberDeleteHandler(c *gin.Context) {
+// resourceHandlers serves the CRUD routes of a registered resource
+type resourceHandlers struct {
+	env *Env
+	res models.Resource
+}
 
-	input := models.Member{ID: c.Param("id")}
-	// var req models.Databox = &models.Member{ID: userID}
-	member, err := env.db.Delete(input)
+// conditional returns the Datastore to write the record through, honoring the If-Match header as well
+func (h resourceHandlers) conditional(c *gin.Context) (models.Datastore, error) {
 
-	// member, err := req.Delete()
+	header := c.GetHeader("If-Match")
+	switch {
+	case header == "" && h.env.requireIfMatch:
+		return nil, models.NewError(models.ErrPreconditionRequired, "If-Match Header Required", nil)
+	case header == "" || header == "*":
+		return h.datastore(c), nil
+	}
+	versions, err := models.ParseETags(header)
 	if err != nil {
-		switch err.Error() {
-		case "User Not Found":
-			c.JSON(http.StatusNotFound, gin.H{"Error": "User Not Found"})
-			return
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Internal Server Error"})
-			return
+		return nil, err
+	}
+	return h.datastore(c).IfMatch(versions...), nil
+}
+
+// SetRoutes mounts the routes of every registered resource on router
+func (env *Env) SetRoutes(router gin.IRouter) {
+	router.Use(setRequestID, claimActor, env.setCacheControl)
+	router.GET("/livez", env.Livez)
+	router.GET("/readyz", env.Readyz)
+	// healthz is the liveness probe of old
+	router.GET("/healthz", env.Livez)
+	router.GET("/audit", env.requireAdmin, env.Audit)
+	router.GET("/debug/db", env.requireAdmin, env.DebugDB)
+	for _, res := range models.Resources() {
+		h := resourceHandlers{env: env, res: res}
+		router.GET("/"+res.Plural, h.List)
+		router.GET("/"+res.Name+"/:id", h.Get)
+		router.POST("/"+res.Name, h.Post)
+		router.PUT("/"+res.Name, h.Put)
+		router.PATCH("/"+res.Name+"/:id", h.Patch)
+		router.DELETE("/"+res.Name+"/:id", h.Delete)
+		router.POST("/"+res.Plural+"/bulk", h.Bulk)
+		router.POST("/"+res.Name+"/:id/restore", h.Restore)
+		router.GET("/"+res.Plural+"/trash", env.requireAdmin, h.Trash)
+		router.DELETE("/"+res.Plural+"/trash", env.requireAdmin, h.Purge)
+		if res.RevisionTable != "" {
+			router.GET("/"+res.Name+"/:id/revisions", h.Revisions)
+			router.GET("/"+res.Name+"/:id/revisions/:rev", h.Revision)
+			router.GET("/"+res.Name+"/:id/revisions/:rev/diff", h.RevisionDiff)
+			router.POST("/"+res.Name+"/:id/revisions/:rev/restore", h.RestoreRevision)
 		}
 	}
-	c.JSON(http.StatusOK, member)
 }
 
-func (env *Env) ArticleGetHandler(c *gin.Context) {
+func (h resourceHandlers) List(c *gin.Context) {
 
-	input := models.Article{ID: c.Param("id")}
-	article, err := env.db.Get(input)
+	args, err := h.env.bindListArgs(c, h.res.Model)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result, err := h.datastore(c).List(h.res.Model, args)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newListResponse(args, result))
+}
+
+func (h resourceHandlers) Get(c *gin.Context) {
 
+	visibility, err := h.env.bindVisibility(c)
 	if err != nil {
-		switch err.Error() {
-		case "Article Not Found":
-			c.JSON(http.StatusNotFound, gin.H{"Error": "Article Not Found"})
-			return
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Internal Server Error"})
-			return
-		}
+		abortWithError(c, err)
+		return
+	}
+	item, err := h.datastore(c).Get(h.res.WithID(c.Param("id")))
+	if err == nil && visibility == models.ActiveOnly && h.res.Inactive(item) {
+		err = models.NewError(models.ErrNotFound, h.res.NotFound, nil)
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
-	c.JSON(http.StatusOK, article)
+	h.setValidators(c, item)
+	if h.notModified(c, item) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, item)
 }
 
-func (env *Env) ArticlePostHandler(c *gin.Context) {
+func (h resourceHandlers) Post(c *gin.Context) {
 
-	article := models.Article{}
-	err := c.Bind(&article)
+	item, err := h.res.Decode(c.ShouldBind)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+		abortWithError(c, err)
 		return
 	}
-	if article.ID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid Article ID"})
+	result, err := h.datastore(c).Create(h.res.PrepareCreate(item))
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
-	if !article.CreateTime.Valid {
-		article.CreateTime.Time = time.Now()
-		article.CreateTime.Valid = true
+	c.JSON(http.StatusOK, result)
+}
+
+// Put replaces the whole record, so every required field has to be sent
+func (h resourceHandlers) Put(c *gin.Context) {
+
+	ds, err := h.conditional(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
-	if !article.UpdatedAt.Valid {
-		article.UpdatedAt.Time = time.Now()
-		article.UpdatedAt.Valid = true
+	item, err := h.res.Decode(c.ShouldBind)
+	if err == nil {
+		err = h.res.Validate(item)
 	}
-	if article.Active != 1 {
-		article.Active = 1
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
-	result, err := env.db.Create(article)
+	result, err := ds.Replace(h.res.PrepareUpdate(item))
 	if err != nil {
-		switch err.Error() {
-		case "Duplicate entry":
-			c.JSON(http.StatusBadRequest, gin.H{"Error": "Article ID Already Taken"})
-			return
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
-			return
-		}
+		abortWithError(c, err)
+		return
 	}
+	h.setValidators(c, result)
 	c.JSON(http.StatusOK, result)
 }
 
-func (env *Env) ArticlePutHandler(c *gin.Context) {
+// Patch applies a merge patch or a JSON patch, told apart by Content-Type, to the stored record.
+// The record is read in the transaction which writes it, so from the primary rather than a lagging replica.
+func (h resourceHandlers) Patch(c *gin.Context) {
 
-	article := models.Article{}
-	c.Bind(&article)
-	// Check if article struct was binded successfully
-	if article.ID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid Article Data"})
+	ds, err := h.conditional(c)
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
-	if article.CreateTime.Valid {
-		article.CreateTime.Time = time.Time{}
-		article.CreateTime.Valid = false
+	body, err := c.GetRawData()
+	if err != nil {
+		abortWithError(c, models.NewError(models.ErrValidation, h.res.Invalid, err))
+		return
 	}
-	if !article.UpdatedAt.Valid {
-		article.UpdatedAt.Time = time.Now()
-		article.UpdatedAt.Valid = true
+	var result interface{}
+	err = ds.WithTx(func(tx models.Datastore) error {
+		stored, err := tx.Get(h.res.WithID(c.Param("id")))
+		if err != nil {
+			return err
+		}
+		item, err := h.res.Patch(stored, c.ContentType(), body)
+		if err == nil {
+			err = h.res.Validate(item)
+		}
+		if err != nil {
+			return err
+		}
+		result, err = tx.Replace(h.res.PrepareUpdate(item))
+		return err
+	})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	h.setValidators(c, result)
+	c.JSON(http.StatusOK, result)
+}
+
+func (h resourceHandlers) Delete(c *gin.Context) {
+
+	ds, err := h.conditional(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
-	result, err := env.db.Update(article)
+	result, err := ds.Delete(h.res.WithID(c.Param("id")))
 	if err != nil {
-		switch err.Error() {
-		case "Article Not Found":
-			c.JSON(http.StatusBadRequest, gin.H{"Error": "Article Not Found"})
-			return
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Internal Server Error"})
-			return
-		}
+		abortWithError(c, err)
+		return
 	}
 	c.JSON(http.StatusOK, result)
 }
 
-func (env *Env) ArticleDeleteHandler(c *gin.Context) {
+// addressList holds the addresses set with a repeated flag
+type addressList []string
 
-	input := models.Article{ID: c.Param("id")}
-	// var req models.Databox = &models.Member{ID: userID}
-	article, err := env.db.Delete(input)
+func (addresses *addressList) String() string {
+	return strings.Join(*addresses, " ")
+}
 
-	// member, err := req.Delete()
-	if err != nil {
-		switch err.Error() {
-		case "Article Not Found":
-			c.JSON(http.StatusNotFound, gin.H{"Error": "Article Not Found"})
-			return
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Internal Server Error"})
-			return
-		}
+func (addresses *addressList) Values() []string {
+	return *addresses
+}
+
+func (addresses *addressList) Set(address string) error {
+	*addresses = append(*addresses, address)
+	return nil
+}
+
+// dataSource returns the DSN of the database at address for the driver, logging in as the SQL user
+func dataSource(driver string, address string) string {
+	switch driver {
+	case "postgres":
+		// The SSL mode and the like are taken from the PG* environment variables
+		return (&url.URL{Scheme: "postgres", User: url.UserPassword(*sqlUser, *sqlAuth), Host: address, Path: *sqlDB}).String()
+	case "sqlite3":
+		return address
 	}
-	c.JSON(http.StatusOK, article)
+	// clientFoundRows makes updates which change nothing still count the row they matched
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true&clientFoundRows=true", *sqlUser, *sqlAuth, address, *sqlDB)
 }
 
 func main() {
+	cacheControl := cacheRules{}
+	flag.Var(cacheControl, "cache-control", "Cache-Control directives of the GET responses of a route, as PATH=DIRECTIVES, e.g. /article/:id=public,max-age=60; repeatable")
+	replicas := addressList{}
+	flag.Var(&replicas, "sql-replica", "Address of a read replica of the SQL server, logged in to as the SQL user, or its file with sqlite3; repeatable")
+	cacheTTL := cacheTTLs{}
+	flag.Var(cacheTTL, "cache-ttl", "How long the records of a resource stay in the read cache, as RESOURCE=DURATION, e.g. article=1m; repeatable")
 	flag.Parse()
-	fmt.Printf("sql user:%s, sql address:%s, auth:%s \n", *sqlUser, *sqlAddress, *sqlAuth)
+	if err := loadConfig(flag.CommandLine, os.LookupEnv); err != nil {
+		log.Fatal(err)
+	}
+	if flag.Arg(0) == "config" {
+		if flag.Arg(1) != "print" {
+			log.Fatal("usage: config print")
+		}
+		if err := printConfig(flag.CommandLine, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	fmt.Printf("sql user:%s, sql address:%s \n", *sqlUser, *sqlAddress)
 	// db, err := sqlx.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s)/memberdb", *sqlUser, *sqlAuth, *sqlAddress))
-	dbURI := fmt.Sprintf("%s:%s@tcp(%s)/memberdb?parseTime=true", *sqlUser, *sqlAuth, *sqlAddress)
-	// Start with default middleware
-	router := gin.Default()
-
+	dbURI := dataSource(*dbDriver, *sqlAddress)
+	if *dbDriver == "sqlite3" {
+		dbURI = *sqlitePath
+	}
+	replicaURIs := make([]string, len(replicas))
+	for i, address := range replicas {
+		replicaURIs[i] = dataSource(*dbDriver, address)
+	}
 	// models.InitDB(dbURI)
-	db, err := models.NewDB(dbURI)
+	var db *models.DB
+	var err error
+	if *dbDriver == "memory" {
+		db, err = models.NewMemoryDB()
+	} else {
+		db, err = models.NewDB(*dbDriver, dbURI, replicaURIs...)
+	}
 	if err != nil {
 		log.Panic(err)
 	}
-	env := &Env{db}
+	db.StickyWindow = *readYourWrites
+	db.Audit = *auditLog
+	db.SetPool(models.Pool{MaxOpenConns: *maxOpenConns, MaxIdleConns: *maxIdleConns, ConnMaxLifetime: *connMaxLifetime, ConnMaxIdleTime: *connMaxIdleTime})
+	if flag.Arg(0) == "migrate" {
+		if err := migrate(db, flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// SQLite databases are for local development, and start in memory, so they are brought up to date right away
+	if *dbDriver == "sqlite3" {
+		if err := migrate(db, []string{"up"}, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := checkSchema(db, *schemaCheck); err != nil {
+		log.Fatal(err)
+	}
+	// Start with default middleware
+	router := gin.Default()
+
+	var ds models.Datastore = db
+	if *cacheSize > 0 {
+		ds = models.NewCachedDatastore(db, models.NewLRU(*cacheSize), models.CacheTTLs(cacheTTL))
+	}
+	env := &Env{db: ds, requireIfMatch: *requireIfMatch, cacheControl: cacheControl, trashRetention: *trashRetention, adminToken: *adminToken, poolStats: db.PoolStats, health: db.Health}
 	// Plug in mySQL middleware
 	// router.Use(sqlMiddleware(dbConn))
 
-	router.GET("/healthz", func(c *gin.Context) {
-		c.String(http.StatusOK, "")
-	})
-
-	router.GET("/member/:id", env.MemberGetHandler)
-	router.POST("/member", env.MemberPostHandler)
-	router.PUT("/member", env.MemberPutHandler)
-	router.DELETE("/member/:id", env.MemberDeleteHandler)
+	env.SetRoutes(router)
 
-	router.GET("/article/:id", env.ArticleGetHandler)
-	router.POST("/article", env.ArticlePostHandler)
-	router.PUT("/article", env.ArticlePutHandler)
-	router.DELETE("/article/:id", env.ArticleDeleteHandler)
-
-	router.Run()
+	server := &http.Server{Addr: *listen, Handler: router, ReadTimeout: *readTimeout, WriteTimeout: *writeTimeout}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	<-stop
+	// Keep serving, unready, until the load balancer stops sending requests, then let those in flight complete
+	log.Printf("shutting down in %s", *shutdownDelay)
+	env.drain()
+	time.Sleep(*shutdownDelay)
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownGrace)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	db.Close()
 }
@@ -2,24 +2,31 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/readr-media/readr-restful/models"
 )
 
-type mockDB struct{}
-
 var memberList = []models.Member{
 	models.Member{
 		ID:     "TaiwanNo.1",
-		Active: true,
+		Active: models.NullBool{Bool: true, Valid: true},
+	},
+	models.Member{
+		ID:     "Formosa",
+		Active: models.NullBool{Bool: true, Valid: true},
 	},
 }
 
@@ -27,134 +34,78 @@ var articleList = []models.Article{
 	models.Article{
 		ID:     "3345678",
 		Author: models.NullString{String: "李宥儒", Valid: true},
-		Active: 1,
+		Active: models.NullInt{Int: 1, Valid: true},
 	},
 }
 var env Env
 
-// ------------------------ Implementation of Datastore interface ---------------------------
-func (mdb *mockDB) Get(item models.TableStruct) (models.TableStruct, error) {
+// lastCaller and lastAuditQuery record the arguments of the latest As and ListAudit calls
+var (
+	lastCaller     models.Caller
+	lastAuditQuery models.AuditQuery
+)
 
-	var (
-		result models.TableStruct
-		err    error
-	)
-	switch item := item.(type) {
-	case models.Member:
-		result = models.Member{}
-		err = errors.New("User Not Found")
-		for _, value := range memberList {
-			if item.ID == value.ID {
-				result = value
-				err = nil
-			}
-		}
-	case models.Article:
-		result = models.Member{}
-		err = errors.New("Article Not Found")
-		for _, value := range articleList {
-			if item.ID == value.ID {
-				result = value
-				err = nil
-			}
-		}
-	default:
-		log.Fatal("Can't not parse model type")
-	}
-	return result, err
+// lastListArgs records the arguments of the latest List call for assertions
+var lastListArgs models.ListArgs
+
+// recordingDB runs on the in-memory Datastore and records the arguments tests assert on
+type recordingDB struct {
+	models.Datastore
 }
 
-func (mdb *mockDB) Create(item models.TableStruct) (interface{}, error) {
+func (rdb recordingDB) List(item models.TableStruct, args models.ListArgs) (models.ListResult, error) {
+	lastListArgs = args
+	return rdb.Datastore.List(item, args)
+}
 
-	var (
-		result models.TableStruct
-		err    error
-	)
-	switch item := item.(type) {
-	case models.Member:
-		for _, member := range memberList {
-			if item.ID == member.ID {
-				return models.Member{}, errors.New("Duplicate entry")
-			}
-		}
-		memberList = append(memberList, item)
-		result = memberList[len(memberList)-1]
-		err = nil
-	case models.Article:
-		for _, article := range articleList {
-			if item.ID == article.ID {
-				result = models.Article{}
-				err = errors.New("Duplicate entry")
-				return result, err
-			}
-		}
-		articleList = append(articleList, item)
-		result = articleList[len(articleList)-1]
-		err = nil
-	}
-	return result, err
+func (rdb recordingDB) ListAudit(q models.AuditQuery) ([]models.AuditEntry, int, error) {
+	lastAuditQuery = q
+	return rdb.Datastore.ListAudit(q)
 }
 
-func (mdb *mockDB) Update(item models.TableStruct) (interface{}, error) {
-	var (
-		result models.TableStruct
-		err    error
-	)
-	switch item := item.(type) {
-	case models.Member:
-		result = models.Member{}
-		err = errors.New("User Not Found")
-		for _, value := range memberList {
-			if value.ID == item.ID {
-				result = item
-				err = nil
-			}
-		}
-	case models.Article:
-		result = models.Article{}
-		err = errors.New("Article Not Found")
-		for index, value := range articleList {
-			if value.ID == item.ID {
-				articleList[index].LikeAmount = item.LikeAmount
-				articleList[index].Title = item.Title
-				return articleList[index], nil
-			}
+func (rdb recordingDB) As(caller models.Caller) models.Datastore {
+	lastCaller = caller
+	return recordingDB{rdb.Datastore.As(caller)}
+}
+
+// failingDB fails every Get with err, standing in for an unhealthy database
+type failingDB struct {
+	models.Datastore
+	err error
+}
+
+func (fdb *failingDB) Get(item models.TableStruct) (models.TableStruct, error) {
+	return nil, fdb.err
+}
+
+func (fdb *failingDB) As(caller models.Caller) models.Datastore {
+	return fdb
+}
+
+// seed writes records straight to the Datastore, as they are given
+func seed(t *testing.T, items ...models.TableStruct) {
+	for _, item := range items {
+		if _, err := env.db.Create(item); err != nil {
+			t.Fatal(err)
 		}
 	}
-	return result, err
 }
 
-func (mdb *mockDB) Delete(item models.TableStruct) (interface{}, error) {
-	var (
-		result models.TableStruct
-		err    error
-	)
-	switch item := item.(type) {
-	case models.Member:
-		result = models.Member{}
-		err = errors.New("User Not Found")
-		for index, value := range memberList {
-			if item.ID == value.ID {
-				memberList[index].Active = false
-				return memberList[index], nil
-			}
-		}
-	case models.Article:
-		result = models.Article{}
-		err = errors.New("Article Not Found")
-		for index, value := range articleList {
-			if item.ID == value.ID {
-				articleList[index].Active = 0
-				return articleList[index], nil
-			}
-		}
-	default:
-		log.Fatal("Can't not parse model type")
+// assertProblem checks that w holds a problem details body with code and detail
+func assertProblem(t *testing.T, w *httptest.ResponseRecorder, code string, detail string) {
+
+	if w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("Expected problem content type, got %s", w.Header().Get("Content-Type"))
+	}
+	var resp problem
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != w.Code || resp.Code != code || resp.Detail != detail {
+		t.Errorf("Expected %s problem \"%s\", got %s", code, detail, w.Body.String())
 	}
-	return result, err
 }
 
-// ---------------------------------- End of Datastore implementation --------------------------------
 // var r = gin.Default()
 var r *gin.Engine
 
@@ -162,17 +113,26 @@ func TestMain(m *testing.M) {
 	gin.SetMode(gin.TestMode)
 
 	r = gin.Default()
-	r.GET("/member/:id", env.MemberGetHandler)
-	r.POST("/member", env.MemberPostHandler)
-	r.PUT("/member", env.MemberPutHandler)
-	r.DELETE("/member/:id", env.MemberDeleteHandler)
-
-	r.GET("/article/:id", env.ArticleGetHandler)
-	r.POST("/article", env.ArticlePostHandler)
-	r.PUT("/article", env.ArticlePutHandler)
-	r.DELETE("/article/:id", env.ArticleDeleteHandler)
+	env.SetRoutes(r)
 
-	env.db = &mockDB{}
+	db, err := models.NewMemoryDB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fixtures := []models.TableStruct{}
+	for _, member := range memberList {
+		fixtures = append(fixtures, member)
+	}
+	for _, article := range articleList {
+		fixtures = append(fixtures, article)
+	}
+	for _, item := range fixtures {
+		if _, err := db.Create(item); err != nil {
+			log.Fatal(err)
+		}
+	}
+	env.db = recordingDB{db}
+	env.trashRetention = 30 * 24 * time.Hour
 	os.Exit(m.Run())
 }
 
@@ -213,10 +173,7 @@ func TestGetNotExistMember(t *testing.T) {
 		t.Fail()
 	}
 
-	expected := `{"Error":"User Not Found"}`
-	if w.Body.String() != string(expected) {
-		t.Fail()
-	}
+	assertProblem(t, w, "not_found", "User Not Found")
 }
 
 func TestPostEmptyMember(t *testing.T) {
@@ -232,10 +189,7 @@ func TestPostEmptyMember(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Fail()
 	}
-	expected := `{"Error":"Invalid User"}`
-	if w.Body.String() != string(expected) {
-		t.Fail()
-	}
+	assertProblem(t, w, "validation_failed", "Invalid Member Data")
 }
 
 func TestPostMember(t *testing.T) {
@@ -281,13 +235,10 @@ func TestPostExistedMember(t *testing.T) {
 	// r.POST("/member", env.MemberPostHandler)
 	r.ServeHTTP(w, req)
 
-	if w.Code != http.StatusBadRequest {
-		t.Fail()
-	}
-	expected := `{"Error":"User Already Existed"}`
-	if w.Body.String() != string(expected) {
+	if w.Code != http.StatusConflict {
 		t.Fail()
 	}
+	assertProblem(t, w, "conflict", "User Already Existed")
 }
 
 func TestPutMember(t *testing.T) {
@@ -336,13 +287,10 @@ func TestPutNonExistMember(t *testing.T) {
 	// r.PUT("/member", env.MemberPutHandler)
 	r.ServeHTTP(w, req)
 
-	if w.Code != http.StatusBadRequest {
-		t.Fail()
-	}
-	expected := `{"Error":"User Not Found"}`
-	if w.Body.String() != string(expected) {
+	if w.Code != http.StatusNotFound {
 		t.Fail()
 	}
+	assertProblem(t, w, "not_found", "User Not Found")
 }
 
 func TestDeleteExistMember(t *testing.T) {
@@ -358,12 +306,20 @@ func TestDeleteExistMember(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fail()
 	}
+
+	env.adminToken = "s3cret"
+	defer func() { env.adminToken = "" }()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/member/TaiwanNo.1?include_inactive=true", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	r.ServeHTTP(w, req)
+
 	var resp models.Member
 	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
 		log.Fatal(err)
 	}
-	if resp.Active == true {
-		t.Fail()
+	if w.Code != http.StatusOK || !resp.Active.Valid || resp.Active.Bool {
+		t.Errorf("expected the member to be stored inactive, got %d %s", w.Code, w.Body.String())
 	}
 }
 
@@ -378,10 +334,45 @@ func TestDeleteNonExistMember(t *testing.T) {
 	if w.Code != http.StatusNotFound {
 		t.Fail()
 	}
-	expected := `{"Error":"User Not Found"}`
-	if w.Body.String() != string(expected) {
+	assertProblem(t, w, "not_found", "User Not Found")
+}
+
+// ------------------------------------ List Member Test ------------------------------------
+func TestListMembers(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/members?limit=1&offset=1", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fail()
+	}
+	var resp struct {
+		Items []models.Member `json:"_items"`
+		Meta  listMeta        `json:"_meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		log.Fatal(err)
+	}
+	// TaiwanNo.1 has been deleted, leaving the member posted above, newest first, and Formosa
+	if resp.Meta.Total != 2 || resp.Meta.Limit != 1 || resp.Meta.Offset != 1 {
+		t.Fail()
+	}
+	if len(resp.Items) != 1 || resp.Items[0].ID != "Formosa" {
+		t.Fail()
+	}
+}
+
+func TestListMembersInvalidLimit(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/members?limit=0", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
 		t.Fail()
 	}
+	assertProblem(t, w, "validation_failed", "Invalid Limit")
 }
 
 // ---------------------------------- Article Test -------------------------------
@@ -411,10 +402,7 @@ func TestGetNonExistedArticle(t *testing.T) {
 		t.Fail()
 	}
 
-	expected := `{"Error":"Article Not Found"}`
-	if w.Body.String() != string(expected) {
-		t.Fail()
-	}
+	assertProblem(t, w, "not_found", "Article Not Found")
 }
 
 func TestPostArticle(t *testing.T) {
@@ -460,10 +448,7 @@ func TestPostEmptyArticle(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Fail()
 	}
-	expected := `{"Error":"Invalid Article ID"}`
-	if w.Body.String() != string(expected) {
-		t.Fail()
-	}
+	assertProblem(t, w, "validation_failed", "Invalid Article Data")
 }
 
 func TestPostExistingArticle(t *testing.T) {
@@ -476,13 +461,10 @@ func TestPostExistingArticle(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 
-	if w.Code != http.StatusBadRequest {
-		t.Fail()
-	}
-	expected := `{"Error":"Article ID Already Taken"}`
-	if w.Body.String() != string(expected) {
+	if w.Code != http.StatusConflict {
 		t.Fail()
 	}
+	assertProblem(t, w, "conflict", "Article ID Already Taken")
 }
 
 // ------------------------------------ Update Article Test ------------------------------------
@@ -490,6 +472,7 @@ func TestPutArticle(t *testing.T) {
 	w := httptest.NewRecorder()
 	var jsonStr = []byte(`{
 		"id":"3345678",
+		"author":"李宥儒",
 		"liked": 113,
 		"title": "台北不是我的家！？租屋黑市大揭露"
 	}`)
@@ -515,21 +498,142 @@ func TestPutArticle(t *testing.T) {
 	}
 }
 
+func TestPutDeletedArticle(t *testing.T) {
+
+	seed(t, models.Article{
+		ID:         "trash-put",
+		Author:     models.NullString{String: "洪晟熊", Valid: true},
+		CreateTime: models.NullTime{Time: time.Date(2017, 11, 1, 8, 0, 0, 0, time.UTC), Valid: true},
+		Active:     models.NullInt{Int: 0, Valid: true},
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/article", bytes.NewBufferString(`{"id":"trash-put","author":"洪晟熊","title":"數讀政治獻金"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	var resp models.Article
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || !resp.CreateTime.Valid || resp.Active.Int != 0 || !resp.Active.Valid {
+		t.Errorf("expected the stored article, still in the trash, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/article/trash-put", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected the article to stay deleted, got %d %s", w.Code, w.Body.String())
+	}
+}
+
 func TestPutNonExistingArticle(t *testing.T) {
 	w := httptest.NewRecorder()
 	var jsonStr = []byte(`{
 		"id": "98765",
+		"author": "洪晟熊",
 		"Title": "數讀政治獻金"
 	}`)
 	req, _ := http.NewRequest("PUT", "/article", bytes.NewBuffer(jsonStr))
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 
+	if w.Code != http.StatusNotFound {
+		t.Fail()
+	}
+	assertProblem(t, w, "not_found", "Article Not Found")
+}
+
+func TestPutArticleWithoutRequiredField(t *testing.T) {
+	w := httptest.NewRecorder()
+	var jsonStr = []byte(`{
+		"id":"3345678",
+		"liked": 113
+	}`)
+	req, _ := http.NewRequest("PUT", "/article", bytes.NewBuffer(jsonStr))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
 	if w.Code != http.StatusBadRequest {
 		t.Fail()
 	}
-	expected := `{"Error":"Article Not Found"}`
-	if w.Body.String() != string(expected) {
+	assertProblem(t, w, "validation_failed", "Missing Required Field: author")
+}
+
+// ------------------------------------ Patch Article Test ------------------------------------
+func TestMergePatchArticle(t *testing.T) {
+	w := httptest.NewRecorder()
+	var jsonStr = []byte(`{"og_title": "租屋黑市大揭露", "title": null}`)
+	req, _ := http.NewRequest("PATCH", "/article/3345678", bytes.NewBuffer(jsonStr))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	r.ServeHTTP(w, req)
+
+	// Title is required, so it can't be removed
+	if w.Code != http.StatusBadRequest {
+		t.Fail()
+	}
+
+	w = httptest.NewRecorder()
+	jsonStr = []byte(`{"og_title": "租屋黑市大揭露", "liked": 200}`)
+	req, _ = http.NewRequest("PATCH", "/article/3345678", bytes.NewBuffer(jsonStr))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fail()
+	}
+	var resp models.Article
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		log.Fatal(err)
+	}
+	if resp.OgTitle.String != "租屋黑市大揭露" || resp.LikeAmount.Int != 200 || resp.Title.String != "台北不是我的家！？租屋黑市大揭露" {
+		t.Fail()
+	}
+}
+
+func TestJSONPatchArticle(t *testing.T) {
+	w := httptest.NewRecorder()
+	var jsonStr = []byte(`[
+		{"op": "test", "path": "/liked", "value": 200},
+		{"op": "replace", "path": "/liked", "value": 201},
+		{"op": "remove", "path": "/og_title"}
+	]`)
+	req, _ := http.NewRequest("PATCH", "/article/3345678", bytes.NewBuffer(jsonStr))
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fail()
+	}
+	stored, err := env.db.Get(models.Article{ID: "3345678"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article := stored.(models.Article); article.LikeAmount.Int != 201 || article.OgTitle.Valid {
+		t.Fail()
+	}
+}
+
+func TestPatchArticleID(t *testing.T) {
+	w := httptest.NewRecorder()
+	var jsonStr = []byte(`[{"op": "replace", "path": "/id", "value": "9528"}]`)
+	req, _ := http.NewRequest("PATCH", "/article/3345678", bytes.NewBuffer(jsonStr))
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fail()
+	}
+	assertProblem(t, w, "validation_failed", "Primary Key Cannot Be Changed")
+}
+
+func TestPatchNonExistingArticle(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/article/98765", bytes.NewBuffer([]byte(`{"liked": 1}`)))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
 		t.Fail()
 	}
 }
@@ -548,7 +652,7 @@ func TestDeleteExistingArticle(t *testing.T) {
 	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
 		log.Fatal(err)
 	}
-	if resp.Active != 0 {
+	if resp.Active.Int != 0 {
 		t.Fail()
 	}
 }
@@ -562,8 +666,783 @@ func TestDeleteNonExistingArticle(t *testing.T) {
 	if w.Code != http.StatusNotFound {
 		t.Fail()
 	}
-	expected := `{"Error":"Article Not Found"}`
-	if w.Body.String() != string(expected) {
+	assertProblem(t, w, "not_found", "Article Not Found")
+}
+
+// ------------------------------------ List Article Test ------------------------------------
+func TestListArticles(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/articles", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fail()
+	}
+	var resp struct {
+		Items []models.Article `json:"_items"`
+		Meta  listMeta         `json:"_meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		log.Fatal(err)
+	}
+	// 3345678 has been deleted, leaving the article posted above
+	if resp.Meta.Total != 1 || resp.Meta.Limit != models.DefaultListLimit || len(resp.Items) != 1 || resp.Items[0].ID != "9527" {
+		t.Fail()
+	}
+}
+
+func TestListArticlesWithFilters(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/articles?author=李宥儒&like_amount_gte=100&created_after=2017-10-01&sort=-liked,created_at", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fail()
+	}
+	expectedFilters := []models.Filter{
+		{Column: "author", Operator: "=", Values: []interface{}{"李宥儒"}},
+		{Column: "create_time", Operator: ">", Values: []interface{}{time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC)}},
+		{Column: "like_amount", Operator: ">=", Values: []interface{}{100}},
+	}
+	expectedSorts := []models.Sort{{Column: "like_amount", Desc: true}, {Column: "create_time", Desc: false}}
+	if !reflect.DeepEqual(lastListArgs.Filters, expectedFilters) || !reflect.DeepEqual(lastListArgs.Sorts, expectedSorts) {
+		t.Fail()
+	}
+}
+
+func TestListArticlesWithInvalidFilters(t *testing.T) {
+
+	for _, query := range []string{"password=123", "author_gte=abc", "like_amount=many", "active_after=2017-10-01"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/articles?"+query, nil)
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestListArticlesWithInvalidSort(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/articles?sort=-post_id%3BDROP%20TABLE%20article_infos", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fail()
+	}
+}
+
+func TestListArticlesWithCursor(t *testing.T) {
+
+	token := base64.RawURLEncoding.EncodeToString([]byte(`{"k":["-like_amount","-post_id"],"v":["113","3345678"]}`))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/articles?sort=-like_amount&cursor="+token, nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fail()
+	}
+	expected := &models.Cursor{
+		Sorts:  []models.Sort{{Column: "like_amount", Desc: true}, {Column: "post_id", Desc: true}},
+		Values: []interface{}{113, "3345678"},
+	}
+	if !reflect.DeepEqual(lastListArgs.Cursor, expected) {
+		t.Fail()
+	}
+}
+
+func TestListArticlesWithInvalidCursor(t *testing.T) {
+
+	tokens := []string{
+		"not-a-cursor",
+		base64.RawURLEncoding.EncodeToString([]byte(`{"k":["password"],"v":["123"]}`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"k":["like_amount"],"v":["many"]}`)),
+	}
+	for _, token := range tokens {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/articles?cursor="+token, nil)
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected cursor %s to be rejected, got %d", token, w.Code)
+		}
+		assertProblem(t, w, "validation_failed", "Invalid Cursor")
+	}
+}
+
+func TestListArticlesWithCursorAndOffset(t *testing.T) {
+
+	token := base64.RawURLEncoding.EncodeToString([]byte(`{"k":["-post_id"],"v":["3345678"]}`))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/articles?offset=20&cursor="+token, nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fail()
+	}
+}
+
+// ------------------------------------ Conditional Article Test ------------------------------------
+func TestGetArticleETag(t *testing.T) {
+
+	seed(t, models.Article{
+		ID:        "etag-get",
+		Author:    models.NullString{String: "洪晟熊", Valid: true},
+		UpdatedAt: models.NullTime{Time: time.Date(2017, 11, 2, 8, 0, 0, 0, time.UTC), Valid: true},
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/article/etag-get", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	versions, err := models.ParseETags(w.Header().Get("ETag"))
+	if err != nil || len(versions) != 1 || !versions[0].Equal(time.Date(2017, 11, 2, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected an ETag derived from updated_at, got %q", w.Header().Get("ETag"))
+	}
+}
+
+func TestPutArticleIfMatch(t *testing.T) {
+
+	seed(t, models.Article{
+		ID:        "etag-put",
+		Author:    models.NullString{String: "洪晟熊", Valid: true},
+		UpdatedAt: models.NullTime{Time: time.Date(2017, 11, 2, 8, 0, 0, 0, time.UTC), Valid: true},
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/article/etag-put", nil)
+	r.ServeHTTP(w, req)
+	etag := w.Header().Get("ETag")
+
+	put := func(etag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/article", bytes.NewBufferString(`{"id":"etag-put","author":"洪晟熊","title":"數讀政治獻金"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", etag)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w = put(etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if w.Header().Get("ETag") == "" || w.Header().Get("ETag") == etag {
+		t.Errorf("expected a new ETag, got %q", w.Header().Get("ETag"))
+	}
+
+	// The first write moved the article to a new version
+	w = put(etag)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected status 412, got %d", w.Code)
+	}
+	assertProblem(t, w, "precondition_failed", "Version Mismatch")
+}
+
+func TestChainedConditionalPuts(t *testing.T) {
+
+	seed(t, models.Article{ID: "etag-chain", Author: models.NullString{String: "洪晟熊", Valid: true}})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/article/etag-chain", nil)
+	r.ServeHTTP(w, req)
+	etag := w.Header().Get("ETag")
+
+	// The writes follow each other within a second, so every version but the first is a second past the previous one
+	for _, title := range []string{"First Draft", "Second Draft", "Third Draft"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("PUT", "/article", bytes.NewBufferString(`{"id":"etag-chain","author":"洪晟熊","title":"`+title+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", etag)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+			t.Fatalf("expected %s to be written under a new ETag, got %d %q %s", title, w.Code, w.Header().Get("ETag"), w.Body.String())
+		}
+		etag = w.Header().Get("ETag")
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/article/etag-chain", nil)
+		r.ServeHTTP(w, req)
+		if w.Header().Get("ETag") != etag {
+			t.Fatalf("expected the ETag of the write to be the stored one, got %q for %q", w.Header().Get("ETag"), etag)
+		}
+	}
+}
+
+func TestPutArticleEchoingUpdatedAt(t *testing.T) {
+
+	seed(t, models.Article{
+		ID:        "etag-echo",
+		Author:    models.NullString{String: "洪晟熊", Valid: true},
+		Title:     models.NullString{String: "數讀政治獻金", Valid: true},
+		UpdatedAt: models.NullTime{Time: time.Date(2017, 11, 2, 8, 0, 0, 0, time.UTC), Valid: true},
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/article/etag-echo", nil)
+	r.ServeHTTP(w, req)
+	etag, body := w.Header().Get("ETag"), w.Body.String()
+
+	// Sending back the record as read, updated_at included, must not keep its version
+	for _, code := range []int{http.StatusOK, http.StatusPreconditionFailed} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/article", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", etag)
+		r.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Fatalf("expected status %d, got %d %s", code, w.Code, w.Body)
+		}
+	}
+}
+
+func TestDeleteArticleWithStaleETag(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/article/3345678", nil)
+	req.Header.Set("If-Match", `W/"stale"`)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fail()
+	}
+	assertProblem(t, w, "precondition_failed", "Version Mismatch")
+}
+
+func TestPatchArticleRequiresIfMatch(t *testing.T) {
+
+	env.requireIfMatch = true
+	defer func() { env.requireIfMatch = false }()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/article/3345678", bytes.NewBufferString(`{"title":"數讀政治獻金"}`))
+	req.Header.Set("Content-Type", models.MergePatchType)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusPreconditionRequired {
+		t.Fail()
+	}
+	assertProblem(t, w, "precondition_required", "If-Match Header Required")
+}
+
+func TestGetArticleNotModified(t *testing.T) {
+
+	updatedAt := time.Date(2017, 11, 2, 8, 0, 0, 0, time.UTC)
+	seed(t, models.Article{
+		ID:        "etag-cache",
+		Author:    models.NullString{String: "洪晟熊", Valid: true},
+		UpdatedAt: models.NullTime{Time: updatedAt, Valid: true},
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/article/etag-cache", nil)
+	r.ServeHTTP(w, req)
+	if w.Header().Get("Last-Modified") != "Thu, 02 Nov 2017 08:00:00 GMT" {
+		t.Errorf("expected Last-Modified from updated_at, got %q", w.Header().Get("Last-Modified"))
+	}
+
+	for _, tc := range []struct {
+		header string
+		value  string
+		code   int
+	}{
+		{"If-None-Match", w.Header().Get("ETag"), http.StatusNotModified},
+		{"If-None-Match", "W/" + w.Header().Get("ETag"), http.StatusNotModified},
+		{"If-None-Match", `"stale"`, http.StatusOK},
+		{"If-Modified-Since", "Thu, 02 Nov 2017 08:00:00 GMT", http.StatusNotModified},
+		{"If-Modified-Since", "Thu, 02 Nov 2017 07:59:59 GMT", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/article/etag-cache", nil)
+		req.Header.Set(tc.header, tc.value)
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s: %s, expected status %d, got %d", tc.header, tc.value, tc.code, w.Code)
+		}
+		if tc.code == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("expected an empty body, got %s", w.Body.String())
+		}
+	}
+}
+
+func TestGetArticleCacheControl(t *testing.T) {
+
+	env.cacheControl = cacheRules{}
+	env.cacheControl.Set("/article/:id=public, max-age=60")
+	defer func() { env.cacheControl = nil }()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/article/etag-cache", nil)
+	r.ServeHTTP(w, req)
+	if w.Header().Get("Cache-Control") != "public, max-age=60" {
+		t.Errorf("expected the configured directives, got %q", w.Header().Get("Cache-Control"))
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/article/does-not-exist", nil)
+	r.ServeHTTP(w, req)
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected errors not to be cached, got %q", w.Header().Get("Cache-Control"))
+	}
+}
+
+// ------------------------------------ Trash Article Test ------------------------------------
+func TestGetDeletedArticle(t *testing.T) {
+
+	seed(t, models.Article{
+		ID:     "trash-get",
+		Author: models.NullString{String: "洪晟熊", Valid: true},
+		Active: models.NullInt{Int: 0, Valid: true},
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/article/trash-get", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected deleted articles to be hidden, got %d", w.Code)
+	}
+
+	env.adminToken = "s3cret"
+	defer func() { env.adminToken = "" }()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/article/trash-get?include_inactive=true", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected include_inactive to be kept to admins, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/article/trash-get?include_inactive=true", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected include_inactive to show deleted articles, got %d", w.Code)
+	}
+}
+
+func TestListArticlesIncludeInactive(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/articles?include_inactive=true", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected include_inactive to be disabled without an admin token, got %d", w.Code)
+	}
+
+	env.adminToken = "s3cret"
+	defer func() { env.adminToken = "" }()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/articles?include_inactive=true", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || lastListArgs.Visibility != models.WithInactive || len(lastListArgs.Filters) != 0 {
+		t.Errorf("expected a list with inactive articles, got %d %+v", w.Code, lastListArgs)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/articles?include_inactive=maybe", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fail()
+	}
+	assertProblem(t, w, "validation_failed", "Invalid include_inactive")
+}
+
+func TestRestoreArticle(t *testing.T) {
+
+	seed(t, models.Article{
+		ID:     "trash-restore",
+		Author: models.NullString{String: "洪晟熊", Valid: true},
+		Active: models.NullInt{Int: 0, Valid: true},
+	})
+
+	env.adminToken = "s3cret"
+	defer func() { env.adminToken = "" }()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/articles/trash", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the trash to be kept to admins, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/articles/trash", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || lastListArgs.Visibility != models.InactiveOnly {
+		t.Fatalf("expected the trash to be listed, got %d %+v", w.Code, lastListArgs)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/article/trash-restore/restore", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp models.Article
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Active.Int != 1 {
+		t.Errorf("expected the article to be active again, got %+v", resp.Active)
+	}
+}
+
+func TestPurgeArticles(t *testing.T) {
+
+	// The server runs west of UTC, while the records are stamped in UTC
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.FixedZone("PST", -8*60*60)
+
+	deletedAt := time.Now().UTC().Add(-env.trashRetention - time.Hour)
+	seed(t,
+		models.Article{ID: "trash-old", Active: models.NullInt{Int: 0, Valid: true}, UpdatedAt: models.NullTime{Time: deletedAt, Valid: true}},
+		models.Article{ID: "trash-new", Active: models.NullInt{Int: 0, Valid: true}, UpdatedAt: models.NullTime{Time: time.Now().UTC(), Valid: true}},
+	)
+
+	env.adminToken = "s3cret"
+	defer func() { env.adminToken = "" }()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/articles/trash", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected purges to be kept to admins, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/articles/trash", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != `{"purged":1}` {
+		t.Errorf("expected one article purged, got %d %s", w.Code, w.Body.String())
+	}
+	if _, err := env.db.Get(models.Article{ID: "trash-new"}); err != nil {
+		t.Errorf("expected recently deleted articles to be kept, got %v", err)
+	}
+}
+
+// ------------------------------------ Article Revision Test ------------------------------------
+func TestArticleRevisions(t *testing.T) {
+
+	seed(t, models.Article{
+		ID:     "rev-article",
+		Author: models.NullString{String: "洪晟熊", Valid: true},
+		Title:  models.NullString{String: "Draft", Valid: true},
+	})
+	for _, title := range []string{"First Draft", "Second Draft"} {
+		if _, err := env.db.Update(models.Article{ID: "rev-article", Title: models.NullString{String: title, Valid: true}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/article/rev-article/revisions", nil)
+	r.ServeHTTP(w, req)
+	var list struct {
+		Items []models.Revision `json:"_items"`
+		Meta  listMeta          `json:"_meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || list.Meta.Total != 3 || len(list.Items) != 3 || list.Items[0].Number != 3 || list.Items[2].Number != 1 {
+		t.Fatalf("expected the revisions of the article numbered from 1, newest first, got %d %s", w.Code, w.Body.String())
+	}
+	first, second := list.Items[1].Number, list.Items[0].Number
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/article/rev-article/revisions/1", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"title":"Draft"`)) {
+		t.Errorf("expected the article as created, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/article/rev-article/revisions/%d/diff", second), nil)
+	r.ServeHTTP(w, req)
+	expected := fmt.Sprintf(`{"changes":[{"field":"title","from":"First Draft","to":"Second Draft"}],"from":%d,"to":%d}`, first, second)
+	if w.Code != http.StatusOK || w.Body.String() != expected {
+		t.Errorf("expected %s, got %d %s", expected, w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/article/rev-article/revisions/%d", second+1000), nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fail()
+	}
+	assertProblem(t, w, "not_found", "Revision Not Found")
+}
+
+func TestRestoreArticleRevision(t *testing.T) {
+
+	revisions, _, err := env.db.ListRevisions(models.Article{ID: "rev-article"}, 1, 1)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("expected the revision of the first draft, got %v %v", revisions, err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/article/rev-article/revisions/%d/restore", revisions[0].Number), bytes.NewBufferString(`{"updated_by":"editor"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	article, err := env.db.Get(models.Article{ID: "rev-article"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := article.(models.Article)
+	if restored.Title.String != "First Draft" || restored.UpdatedBy.String != "editor" || !restored.UpdatedAt.Valid {
+		t.Errorf("expected the first draft restored by the editor, got %+v", restored)
+	}
+}
+
+// ------------------------------------ Bulk Article Test ------------------------------------
+func TestBulkArticlesBestEffort(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	var jsonStr = []byte(`{
+		"mode":"best_effort",
+		"operations":[
+			{"op":"create","item":{"id":"bulk-1","author":"洪晟熊","title":"Bulk One"}},
+			{"op":"create","item":{"id":"3345678","author":"李宥儒"}},
+			{"op":"create","item":{"id":"bulk-2","author":"洪晟熊","title":"Bulk Two"}},
+			{"op":"delete","id":"bulk-1"},
+			{"op":"publish","id":"bulk-2"}
+		]
+	}`)
+	req, _ := http.NewRequest("POST", "/articles/bulk", bytes.NewBuffer(jsonStr))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("expected status 207, got %d", w.Code)
+	}
+	var resp struct {
+		Items []bulkResult `json:"_items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	expected := []int{http.StatusCreated, http.StatusConflict, http.StatusCreated, http.StatusOK, http.StatusBadRequest}
+	if len(resp.Items) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(resp.Items))
+	}
+	for i, status := range expected {
+		if resp.Items[i].Index != i || resp.Items[i].Status != status {
+			t.Errorf("operation %d: expected status %d, got %+v", i, status, resp.Items[i])
+		}
+	}
+	if resp.Items[1].Error == nil || resp.Items[1].Error.Detail != "Article ID Already Taken" {
+		t.Errorf("expected the conflict to be described, got %+v", resp.Items[1].Error)
+	}
+	if _, err := env.db.Get(models.Article{ID: "bulk-2"}); err != nil {
+		t.Errorf("expected bulk-2 to be created, got %v", err)
+	}
+}
+
+func TestBulkArticlesAllOrNothing(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	var jsonStr = []byte(`{
+		"operations":[
+			{"op":"create","item":{"id":"bulk-3","author":"洪晟熊","title":"Bulk Three"}},
+			{"op":"update","item":{}}
+		]
+	}`)
+	req, _ := http.NewRequest("POST", "/articles/bulk", bytes.NewBuffer(jsonStr))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("expected status 207, got %d", w.Code)
+	}
+	var resp struct {
+		Items []bulkResult `json:"_items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Items) != 2 || resp.Items[0].Status != http.StatusFailedDependency || resp.Items[1].Status != http.StatusBadRequest {
+		t.Errorf("expected the create to be aborted by the invalid update, got %+v", resp.Items)
+	}
+	if _, err := env.db.Get(models.Article{ID: "bulk-3"}); err == nil {
+		t.Error("expected bulk-3 not to be created")
+	}
+}
+
+func TestBulkArticlesAllOrNothingTellsTheFailedCreate(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	var jsonStr = []byte(`{
+		"operations":[
+			{"op":"create","item":{"id":"bulk-4","author":"洪晟熊","title":"Bulk Four"}},
+			{"op":"create","item":{"id":"3345678","author":"洪晟熊","title":"Taken"}},
+			{"op":"create","item":{"id":"bulk-5","author":"洪晟熊","title":"Bulk Five"}}
+		]
+	}`)
+	req, _ := http.NewRequest("POST", "/articles/bulk", bytes.NewBuffer(jsonStr))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	var resp struct {
+		Items []bulkResult `json:"_items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	expected := []int{http.StatusFailedDependency, http.StatusConflict, http.StatusFailedDependency}
+	if w.Code != http.StatusMultiStatus || len(resp.Items) != len(expected) {
+		t.Fatalf("expected a status for every create, got %d %s", w.Code, w.Body.String())
+	}
+	for i, status := range expected {
+		if resp.Items[i].Status != status {
+			t.Errorf("operation %d: expected status %d, got %+v", i, status, resp.Items[i])
+		}
+	}
+	if _, err := env.db.Get(models.Article{ID: "bulk-4"}); err == nil {
+		t.Error("expected bulk-4 not to be created")
+	}
+}
+
+func TestBulkArticlesInvalidMode(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/articles/bulk", bytes.NewBufferString(`{"mode":"sometimes","operations":[{"op":"delete","id":"3345678"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fail()
+	}
+	assertProblem(t, w, "validation_failed", "Invalid Bulk Mode")
+}
+
+// ------------------------------------ Audit Test ------------------------------------
+func TestWritesCarryRequestID(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/article", bytes.NewBufferString(`{"id":"audit-1","author":"洪晟熊"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", "req-42")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Header().Get("X-Request-ID") != "req-42" || lastCaller.RequestID != "req-42" {
+		t.Errorf("expected the write to carry the request ID, got %d %+v", w.Code, lastCaller)
+	}
+}
+
+func TestDeletesLogTheirClaimedActor(t *testing.T) {
+
+	seed(t, models.Article{ID: "audit-2", Author: models.NullString{String: "洪晟熊", Valid: true}})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/article/audit-2", nil)
+	req.Header.Set("X-Actor", "editor")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d %s", w.Code, w.Body.String())
+	}
+	entries, _, err := env.db.ListAudit(models.AuditQuery{Resource: "article", RecordID: "audit-2", Limit: 1})
+	if err != nil || len(entries) != 1 || entries[0].Operation != models.AuditDelete {
+		t.Fatalf("expected the delete to be logged, got %+v %v", entries, err)
+	}
+	// Nothing vouches for the header, so it isn't taken for the authenticated actor
+	if entries[0].Actor.Valid || entries[0].ClaimedActor.String != "editor" {
+		t.Errorf("expected the delete to be logged as claimed by the editor, got %+v", entries[0])
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/article/audit-2", nil)
+	req.Header.Set("X-Actor", strings.Repeat("editor", 11))
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fail()
+	}
+	assertProblem(t, w, "validation_failed", "Invalid X-Actor")
+}
+
+func TestAuditRequiresAdminToken(t *testing.T) {
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/audit", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fail()
+	}
+	assertProblem(t, w, "forbidden", "Admin Endpoints Disabled")
+
+	env.adminToken = "s3cret"
+	defer func() { env.adminToken = "" }()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/audit", nil)
+	req.Header.Set("Authorization", "Bearer guess")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fail()
+	}
+	assertProblem(t, w, "unauthorized", "Admin Token Required")
+}
+
+func TestListAudit(t *testing.T) {
+
+	env.adminToken = "s3cret"
+	defer func() { env.adminToken = "" }()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/audit?actor=editor&resource=article&since=2017-11-01T00:00:00Z&limit=5", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	expected := models.AuditQuery{Actor: "editor", Resource: "article", Since: time.Date(2017, 11, 1, 0, 0, 0, 0, time.UTC), Limit: 5}
+	if lastAuditQuery != expected {
+		t.Errorf("expected %+v, got %+v", expected, lastAuditQuery)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/audit?until=yesterday", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fail()
+	}
+	assertProblem(t, w, "validation_failed", "Invalid until")
+}
+
+// ------------------------------------ Database Failure Test ------------------------------------
+func TestGetArticleWhileDatabaseUnavailable(t *testing.T) {
+
+	defer func(db models.Datastore) { env.db = db }(env.db)
+	env.db = &failingDB{Datastore: env.db, err: models.NewError(models.ErrUnavailable, "Service Unavailable", errors.New("invalid connection"))}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/article/3345678", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fail()
+	}
+	assertProblem(t, w, "service_unavailable", "Service Unavailable")
+}
+
+func TestGetArticleHidesInternalError(t *testing.T) {
+
+	defer func(db models.Datastore) { env.db = db }(env.db)
+	env.db = &failingDB{Datastore: env.db, err: errors.New("Error 1054: Unknown column 'post_id' in 'where clause'")}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/article/3345678", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
 		t.Fail()
 	}
+	assertProblem(t, w, "internal_error", "Internal Server Error")
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/readr-media/readr-restful/models"
+)
+
+// newSQLiteRouter serves the API from a fresh in-memory SQLite database, migrated up
+func newSQLiteRouter(t *testing.T) *gin.Engine {
+
+	db, err := models.NewDB("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	if mismatches, err := db.ValidateSchema(); err != nil || len(mismatches) > 0 {
+		t.Fatalf("Expected the migrated schema to match the models, got %v %v", mismatches, err)
+	}
+	router := gin.New()
+	(&Env{db: db, trashRetention: 30 * 24 * time.Hour, adminToken: "secret", poolStats: db.PoolStats}).SetRoutes(router)
+	return router
+}
+
+func serve(router *gin.Engine, method string, path string, body string, header http.Header) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSQLiteArticleLifecycle(t *testing.T) {
+
+	router := newSQLiteRouter(t)
+
+	w := serve(router, "POST", "/article", `{"id":"9527","author":"洪晟熊","title":"數讀政治獻金"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the article to be created, got %d %s", w.Code, w.Body)
+	}
+	w = serve(router, "POST", "/article", `{"id":"9527","author":"洪晟熊","title":"數讀政治獻金"}`, nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected a duplicate article to conflict, got %d %s", w.Code, w.Body)
+	}
+
+	w = serve(router, "GET", "/article/9527", "", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected the article with an ETag, got %d %s", w.Code, w.Body)
+	}
+
+	w = serve(router, "PATCH", "/article/9527", `{"title":"台北不是我的家"}`, http.Header{"If-Match": {etag}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the article to be updated, got %d %s", w.Code, w.Body)
+	}
+	w = serve(router, "PATCH", "/article/9527", `{"title":"數讀政治獻金"}`, http.Header{"If-Match": {etag}})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a stale update to fail, got %d %s", w.Code, w.Body)
+	}
+
+	w = serve(router, "GET", "/articles?author=洪晟熊", "", nil)
+	var list struct {
+		Items []models.Article `json:"_items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || list.Items[0].Title.String != "台北不是我的家" {
+		t.Errorf("Expected the updated article to be listed, got %s", w.Body)
+	}
+
+	w = serve(router, "GET", "/article/9527/revisions", "", nil)
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"revision":1`)) {
+		t.Errorf("Expected the update to be revised, got %d %s", w.Code, w.Body)
+	}
+
+	w = serve(router, "DELETE", "/article/9527", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the article to be deleted, got %d %s", w.Code, w.Body)
+	}
+	if w = serve(router, "GET", "/article/9527", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted article to be hidden, got %d %s", w.Code, w.Body)
+	}
+	if w = serve(router, "POST", "/article/9527/restore", "", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the article to be restored, got %d %s", w.Code, w.Body)
+	}
+
+	w = serve(router, "GET", "/audit?resource=article&id=9527", "", http.Header{"Authorization": {"Bearer secret"}})
+	var audit struct {
+		Items []models.AuditEntry `json:"_items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &audit); err != nil {
+		t.Fatal(err)
+	}
+	// create, update, delete and the restoring update, newest first
+	if len(audit.Items) != 4 || audit.Items[3].Operation != models.AuditCreate {
+		t.Errorf("Expected every write to be audited, got %s", w.Body)
+	}
+}
+
+func TestDebugDBReportsThePoolToAdmins(t *testing.T) {
+
+	router := newSQLiteRouter(t)
+
+	if w := serve(router, "GET", "/debug/db", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the pool stats to require the admin token, got %d %s", w.Code, w.Body)
+	}
+	w := serve(router, "GET", "/debug/db", "", http.Header{"Authorization": {"Bearer secret"}})
+	var stats struct {
+		Pools []models.PoolStats `json:"pools"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(stats.Pools) != 1 || stats.Pools[0].Name != "primary" || stats.Pools[0].MaxOpen != 1 {
+		t.Errorf("Expected the stats of the single SQLite connection, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestReadyzFailsWhileShuttingDownOrWithoutTheDatabase(t *testing.T) {
+
+	db, err := models.NewMemoryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &Env{db: db, health: db.Health}
+	router := gin.New()
+	env.SetRoutes(router)
+
+	w := serve(router, "GET", "/readyz", "", nil)
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`{"name":"primary","up":true,"optional":false}`)) {
+		t.Errorf("Expected the server to be ready, got %d %s", w.Code, w.Body)
+	}
+
+	db.Close()
+	if w = serve(router, "GET", "/readyz", "", nil); w.Code != http.StatusServiceUnavailable || !bytes.Contains(w.Body.Bytes(), []byte(`"unavailable"`)) {
+		t.Errorf("Expected the server to be unready without its database, got %d %s", w.Code, w.Body)
+	}
+	env.drain()
+	if w = serve(router, "GET", "/readyz", "", nil); w.Code != http.StatusServiceUnavailable || !bytes.Contains(w.Body.Bytes(), []byte(`"shutting down"`)) {
+		t.Errorf("Expected the server to be unready while shutting down, got %d %s", w.Code, w.Body)
+	}
+	if w = serve(router, "GET", "/livez", "", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the server to stay live, got %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/readr-media/readr-restful/models"
+)
+
+// bindVisibility reads include_inactive, which makes GETs return records in the trash as well, for admins only
+func (env *Env) bindVisibility(c *gin.Context) (models.Visibility, error) {
+
+	include := c.Query("include_inactive")
+	if include == "" {
+		return models.ActiveOnly, nil
+	}
+	ok, err := strconv.ParseBool(include)
+	if err != nil {
+		return models.ActiveOnly, models.NewError(models.ErrValidation, "Invalid include_inactive", nil)
+	}
+	if !ok {
+		return models.ActiveOnly, nil
+	}
+	if err := env.authorizeAdmin(c); err != nil {
+		return models.ActiveOnly, err
+	}
+	return models.WithInactive, nil
+}
+
+// Restore takes a deleted record out of the trash
+func (h resourceHandlers) Restore(c *gin.Context) {
+
+	ds, err := h.conditional(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	item, err := h.res.Restored(c.Param("id"))
+	if err == nil {
+		_, err = ds.Update(item)
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result, err := h.datastore(c).Get(h.res.WithID(c.Param("id")))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	h.setValidators(c, result)
+	c.JSON(http.StatusOK, result)
+}
+
+// Trash lists the deleted records, paged and filtered like List
+func (h resourceHandlers) Trash(c *gin.Context) {
+
+	args, err := h.env.bindListArgs(c, h.res.Model)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	args.Visibility = models.InactiveOnly
+	result, err := h.datastore(c).List(h.res.Model, args)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newListResponse(args, result))
+}
+
+// Purge deletes for good the records which have been in the trash longer than the retention
+func (h resourceHandlers) Purge(c *gin.Context) {
+
+	purged, err := h.datastore(c).Purge(h.res.Model, time.Now().UTC().Add(-h.env.trashRetention))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}